@@ -0,0 +1,183 @@
+package abs
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/AcSunday/gwatch-chain/metrics"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// addedAddr the address added by AddAddresses, it joins the watched addresses on the next Scan
+type addedAddr struct {
+	addr  common.Address
+	start uint64
+}
+
+// backfillJob history of the added addresses in [next, end], end is the block before they joined the tail
+type backfillJob struct {
+	addrs []common.Address
+	next  uint64
+	end   uint64
+}
+
+// Addresses the watched addresses, the added addresses are included after the next Scan
+func (c *Contract) Addresses() []common.Address {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.Addrs)
+}
+
+// AddAddresses watch addrs from startBlock without restarting the watcher,
+// they join the watched addresses on the next Scan, if startBlock is before the scanned block number,
+// the history is backfilled WatchBlockLimit blocks per Scan while the existing addresses keep tailing.
+// The backfill progress is not persisted, add the addresses again after restart
+func (c *Contract) AddAddresses(startBlock uint64, addrs ...common.Address) error {
+	if c.IsClose.Load() {
+		return errors.New("already closed, adding addresses is prohibited")
+	}
+	if c.AnyContract {
+		return errors.New("any contract mode watches all addresses")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, addr := range addrs {
+		if slices.Contains(c.Addrs, addr) || slices.ContainsFunc(c.addedAddrs, func(a addedAddr) bool { return a.addr == addr }) {
+			continue
+		}
+		c.addedAddrs = append(c.addedAddrs, addedAddr{addr: addr, start: startBlock})
+	}
+	return nil
+}
+
+// RemoveAddresses stop watching addrs, the pending backfill of them is dropped,
+// the last address can not be removed, because empty addresses watch all contracts
+func (c *Contract) RemoveAddresses(addrs ...common.Address) error {
+	if c.IsClose.Load() {
+		return errors.New("already closed, removing addresses is prohibited")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	remain := slices.DeleteFunc(slices.Clone(c.Addrs), func(a common.Address) bool { return slices.Contains(addrs, a) })
+	if len(remain) == 0 && len(c.Addrs) > 0 {
+		return errors.New("can not remove all addresses")
+	}
+
+	c.Addrs = remain
+	c.addedAddrs = slices.DeleteFunc(c.addedAddrs, func(a addedAddr) bool { return slices.Contains(addrs, a.addr) })
+	for _, addr := range addrs {
+		delete(c.addrStart, addr)
+	}
+	jobs := c.backfills[:0]
+	for _, job := range c.backfills {
+		job.addrs = slices.DeleteFunc(job.addrs, func(a common.Address) bool { return slices.Contains(addrs, a) })
+		if len(job.addrs) > 0 {
+			jobs = append(jobs, job)
+		}
+	}
+	c.backfills = jobs
+	return nil
+}
+
+// applyAddresses the added addresses join the tail after the scanned block number
+func (c *Contract) applyAddresses(scanned uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.addedAddrs) == 0 {
+		return
+	}
+
+	// the copy is not shared with the running queries
+	addrs := slices.Clone(c.Addrs)
+	jobs := make(map[uint64]*backfillJob)
+	for _, a := range c.addedAddrs {
+		addrs = append(addrs, a.addr)
+		if a.start > scanned {
+			// skip the logs before the start block
+			if a.start > scanned+1 {
+				c.addrStart[a.addr] = a.start
+			}
+			continue
+		}
+		job, ok := jobs[a.start]
+		if !ok {
+			job = &backfillJob{next: a.start, end: scanned}
+			jobs[a.start] = job
+			c.backfills = append(c.backfills, job)
+		}
+		job.addrs = append(job.addrs, a.addr)
+	}
+	c.Addrs = addrs
+	c.addedAddrs = nil
+}
+
+// addrStarts the start blocks of the added addresses which are ahead of the tail
+func (c *Contract) addrStarts() map[common.Address]uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.addrStart) == 0 {
+		return nil
+	}
+	return maps.Clone(c.addrStart)
+}
+
+// backfill scans WatchBlockLimit blocks of the first backfill job
+func (c *Contract) backfill(ctx context.Context, client *rpcclient.EvmClient, latest uint64) error {
+	c.mu.Lock()
+	for addr, start := range c.addrStart {
+		if start <= c.ProcessedBlockNumber+1 {
+			delete(c.addrStart, addr)
+		}
+	}
+	if len(c.backfills) == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	job := c.backfills[0]
+	addrs, from := slices.Clone(job.addrs), job.next
+	to := min(from+uint64(c.WatchBlockLimit), job.end)
+	c.mu.Unlock()
+
+	ctx = WithScanInfo(ctx, ScanInfo{
+		ChainId:     c.ChainId,
+		Chain:       c.Chain,
+		FromBlock:   from,
+		ToBlock:     to,
+		LatestBlock: latest,
+		Node:        metrics.NodeLabel(client.GetRawUrl()),
+		Backfill:    true,
+	})
+	rpcCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	logs, err := c.filterLogs(rpcCtx, client, c.filterQuery(addrs, int64(from), int64(to)))
+	if err != nil {
+		c.logger().Warn("backfill filter logs failed", "node", metrics.NodeLabel(client.GetRawUrl()),
+			"from_block", from, "to_block", to, "err", err)
+		return err
+	}
+	batch := &Batch{ChainId: c.ChainId, Chain: c.Chain, FromBlock: from, ToBlock: to}
+	err = c.handleLogs(ctx, rpcCtx, client, logs, batch, true)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// the job may be removed by RemoveAddresses
+	i := slices.Index(c.backfills, job)
+	if i < 0 {
+		return nil
+	}
+	job.next = to + 1
+	if job.next > job.end {
+		c.backfills = slices.Delete(c.backfills, i, i+1)
+		c.logger().Info("backfill completed", "contracts", job.addrs, "to_block", job.end)
+	}
+	c.logger().Debug("backfilled block range", "from_block", from, "to_block", to, "contracts", len(addrs), "logs", len(logs))
+	return nil
+}
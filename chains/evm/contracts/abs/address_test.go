@@ -0,0 +1,86 @@
+package abs
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestAddAddresses(t *testing.T) {
+	deposit, late := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	logOf := func(addr common.Address, block uint64) types.Log {
+		l := transferLog(block, 0)
+		l.Address = addr
+		l.TxHash = common.Hash{byte(block), addr[19]}
+		return l
+	}
+
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(120)
+	node.AddLogs(transferLog(101, 0),
+		logOf(deposit, 50), logOf(deposit, 95), logOf(deposit, 104), logOf(deposit, 118),
+		logOf(late, 110), logOf(late, 116))
+	client := node.Client(t)
+
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100, WatchBlockLimit: 5})
+	defer c.Close()
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+	var (
+		seen      []uint64
+		backfills []uint64
+	)
+	c.RegisterEventHookContext(Event(testTransfer.Hex()), func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		seen = append(seen, log.BlockNumber)
+		if info, _ := ScanInfoFromContext(ctx); info.Backfill {
+			backfills = append(backfills, log.BlockNumber)
+		}
+		return nil
+	})
+
+	// tail 101..106
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	c.AddAddresses(90, deposit)
+	c.AddAddresses(115, late)
+	if len(c.Addresses()) != 1 {
+		t.Fatal("added addresses joined before the next Scan")
+	}
+	// tail 107..112, 113..118, 119..120, backfill 90..95, 96..101, 102..106
+	for i := 0; i < 3; i++ {
+		if err := c.Scan(client); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	slices.Sort(seen)
+	if !slices.Equal(seen, []uint64{95, 101, 104, 116, 118}) {
+		t.Fatalf("unexpected blocks: %v", seen)
+	}
+	if !slices.Equal(backfills, []uint64{95, 104}) {
+		t.Fatalf("unexpected backfilled blocks: %v", backfills)
+	}
+	if len(c.backfills) != 0 || c.GetProcessedBlockNumber() != 120 {
+		t.Fatalf("unexpected state: %d backfills, processed %d", len(c.backfills), c.GetProcessedBlockNumber())
+	}
+
+	if err := c.RemoveAddresses(deposit, late); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(c.Addresses(), []common.Address{testToken}) {
+		t.Fatalf("unexpected addresses: %v", c.Addresses())
+	}
+	if err := c.RemoveAddresses(testToken); err == nil {
+		t.Fatal("expected error when removing all addresses")
+	}
+
+	c.Close()
+	if err := c.RemoveAddresses(deposit); err == nil {
+		t.Fatal("expected error when closed")
+	}
+}
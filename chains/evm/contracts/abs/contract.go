@@ -3,16 +3,27 @@ package abs
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/AcSunday/gwatch-chain/rpcclient"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"log/slog"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/AcSunday/gwatch-chain/metrics"
+	"github.com/AcSunday/gwatch-chain/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Event string
 
-const DefaultWatchLimit = 20
+const (
+	DefaultWatchLimit            = 20
+	DefaultAnyContractWatchLimit = 5
+)
 
 type Attrs struct {
 	ChainId              uint64
@@ -21,6 +32,29 @@ type Attrs struct {
 	ProcessedBlockNumber uint64 // has been processed on block number, default is DeployedBlockNumber
 	WatchBlockLimit      int64  // Limit the number of blocks scanned each time, default is 20
 	ContractToDesc       map[string]ContractDesc
+	EventBuffer          int          // buffer size of Events channel, default is 256
+	MaxQueryAddresses    int          // addresses per eth_getLogs, larger sets are sharded, default is 500
+	MaxQueryTopics       int          // topics of a position per eth_getLogs, larger sets are sharded, default is 500
+	QueryConcurrency     int          // concurrent shards of a range, default is 4
+	ScanMode             ScanMode     // how the logs are fetched, default is ScanLogs
+	Logger               *slog.Logger // default is slog.Default()
+	// Name the watcher label of the metrics, default is the watched address or a hash of the watched addresses,
+	//  set it when several watchers of a chain watch the same addresses
+	Name string
+	// TracerProvider spans of scan cycles, rpc calls and hooks, default is otel.GetTracerProvider()
+	TracerProvider trace.TracerProvider
+
+	// AnyContract watch the events of all contracts on the chain, only the topic filters apply and Addrs is ignored,
+	//  the default WatchBlockLimit is 5, and the range shrinks when the node rejects the query, see RegisterWatchEvent
+	AnyContract bool
+	// DiscoverContracts fetch the name, symbol and decimals of the newly seen contracts into ContractToDesc
+	DiscoverContracts bool
+
+	// EnrichBlocks, EnrichTxs and EnrichReceipts batch fetch the headers, the transactions and the receipts
+	//  of the logs before the hooks in json-rpc batches, see EnvelopeFromContext and rpcclient.EvmClient.SetBatchSize
+	EnrichBlocks   bool
+	EnrichTxs      bool
+	EnrichReceipts bool
 }
 
 type ContractDesc struct {
@@ -38,20 +72,71 @@ type Contract struct {
 	IsRunning atomic.Bool
 	IsClose   atomic.Bool
 
-	handleFunc map[Event]func(client *rpcclient.EvmClient, log types.Log) error // key is event
-	mu         sync.RWMutex
-	ctx        context.Context
-	cancel     context.CancelFunc
+	handleFunc       hookRegistry           // key is event, AnyEvent or unhandledEvent
+	middlewares      []Middleware           // every Hook
+	eventMiddlewares map[Event][]Middleware // key is event
+	sinks            []Sink
+	addedAddrs       []addedAddr               // join Addrs on the next Scan
+	addrStart        map[common.Address]uint64 // start block of the added addresses ahead of the tail
+	backfills        []*backfillJob
+	filters          []topicSet // see RegisterFilter
+	logSource        LogSource  // see RegisterLogSource
+	blockLimit       int64      // adaptive range size of AnyContract mode
+	undiscoverable   map[common.Address]struct{}
+	enrichCache      enrichCache
+	decoder          Decoder
+	tracer           trace.Tracer
+	watcher          string // metrics label, see Attrs.Name
+	mu               sync.RWMutex
+	ctx              context.Context
+	cancel           context.CancelFunc
+
+	// streaming mode, see Events
+	events             chan EventEnvelope
+	eventsClosed       bool
+	scannedBlockNumber uint64 // scanned ahead of the processed block number
+	streamRanges       []*streamRange
+	streamMu           sync.Mutex
+	sendMu             sync.Mutex
+	ackMu              sync.Mutex
 }
 
 func (c *Contract) Init(attrs Attrs) {
 	c.Topics = make([][]common.Hash, 1)
-	c.handleFunc = make(map[Event]func(client *rpcclient.EvmClient, log types.Log) error, 4)
+	c.handleFunc = hookRegistry{}
+	c.eventMiddlewares = make(map[Event][]Middleware)
+	c.addrStart = make(map[common.Address]uint64)
 
 	c.Attrs = attrs
 	if c.WatchBlockLimit <= 0 {
 		c.WatchBlockLimit = DefaultWatchLimit
+		if c.AnyContract {
+			c.WatchBlockLimit = DefaultAnyContractWatchLimit
+		}
+	}
+	c.blockLimit = c.WatchBlockLimit
+	if c.ContractToDesc == nil {
+		c.ContractToDesc = make(map[string]ContractDesc)
 	}
+	c.undiscoverable = make(map[common.Address]struct{})
+	if c.MaxQueryAddresses <= 0 {
+		c.MaxQueryAddresses = DefaultMaxQueryAddresses
+	}
+	if c.MaxQueryTopics <= 0 {
+		c.MaxQueryTopics = DefaultMaxQueryTopics
+	}
+	if c.QueryConcurrency <= 0 {
+		c.QueryConcurrency = DefaultQueryConcurrency
+	}
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	c.tracer = tracing.Tracer(c.TracerProvider)
+	addrs := make([]string, len(c.Addrs))
+	for i, addr := range c.Addrs {
+		addrs[i] = addr.Hex()
+	}
+	c.watcher = metrics.WatcherLabel(c.Name, addrs...)
 	if c.DeployedBlockNumber-1 > 0 && c.ProcessedBlockNumber < c.DeployedBlockNumber {
 		c.ProcessedBlockNumber = c.DeployedBlockNumber - 1
 	}
@@ -67,6 +152,8 @@ func (c *Contract) Close() error {
 		c.cancel()
 		c.IsRunning.Store(false)
 		c.IsClose.Store(true)
+		c.closeEvents()
+		return c.closeSinks()
 	}
 	return nil
 }
@@ -80,69 +167,169 @@ func (c *Contract) DoneSignal() <-chan struct{} {
 
 // RegisterWatchEvent topics[0] is smart contract event
 func (c *Contract) RegisterWatchEvent(events ...Event) error {
-	if c.IsRunning.Load() && len(c.Topics[0]) > 0 {
-		return errors.New("already running, Registration of events is prohibited")
+	if c.IsClose.Load() {
+		return errors.New("already closed, Registration of events is prohibited")
 	}
 
-	sli := make([]common.Hash, 0, len(events))
+	c.mu.Lock()
 	for _, event := range events {
-		sli = append(sli, common.HexToHash(event.String()))
+		topic := common.HexToHash(event.String())
+		if !slices.Contains(c.Topics[0], topic) {
+			c.Topics[0] = append(c.Topics[0], topic)
+		}
 	}
-	c.mu.Lock()
-	c.Topics[0] = append(c.Topics[0], sli...)
 	c.mu.Unlock()
 	return nil
 }
 
 // RegisterWatchTopics topic is smart contract event parameter
 //
-//	topicsIndex: [0-3]
-//	event topics
+//	topicsIndex: [0-3], the positions before topicsIndex without topics are wildcard
+//	event topics, use RegisterFilter for the constraints per event
 func (c *Contract) RegisterWatchTopics(topicsIndex int, topics ...common.Hash) error {
 	if c.IsClose.Load() {
 		return errors.New("already closed, Registration of topics is prohibited")
 	}
-	if topicsIndex > 3 {
-		return errors.New("invalid topic index")
+	if topicsIndex < 0 || topicsIndex > 3 {
+		return fmt.Errorf("invalid topic index %d, the range is [0-3]", topicsIndex)
 	}
 
 	c.mu.Lock()
-	for i := len(c.Topics); i <= topicsIndex; i++ {
-		c.Topics = append(c.Topics, []common.Hash{})
+	for len(c.Topics) <= topicsIndex {
+		c.Topics = append(c.Topics, nil)
 	}
-	if topicsIndex < len(c.Topics) {
-		c.Topics[topicsIndex] = append(c.Topics[topicsIndex], topics...)
+	for _, topic := range topics {
+		if !slices.Contains(c.Topics[topicsIndex], topic) {
+			c.Topics[topicsIndex] = append(c.Topics[topicsIndex], topic)
+		}
 	}
 	c.mu.Unlock()
 	return nil
 }
 
-// RegisterEventHook Hook is a function that handles event,
+// RegisterEventHook Hook is a function that handles event, the hooks of an event are called in order of registration,
 // HandleEvent method call this Hook
 func (c *Contract) RegisterEventHook(event Event, f func(client *rpcclient.EvmClient, log types.Log) error) error {
+	_, err := c.AddEventHook(event, AdaptHook(f))
+	return err
+}
+
+// RegisterEventHookContext Hook receives the context of the scan, see HookFunc,
+// HandleEvent method call this Hook
+func (c *Contract) RegisterEventHookContext(event Event, f HookFunc) error {
+	_, err := c.AddEventHook(event, f)
+	return err
+}
+
+// AddEventHook appends the Hook of event and returns the handle to remove it,
+// the Hook of AnyEvent is called for every event after the hooks of the event
+func (c *Contract) AddEventHook(event Event, f HookFunc) (Unregister, error) {
+	return c.addHook(event, f)
+}
+
+// AddUnhandledEventHook Hook of the logs whose event has no Hook, e.g. the watched event without Hook,
+// or any event of the contracts when RegisterWatchEvent is not called, the catch-all hooks are still called
+func (c *Contract) AddUnhandledEventHook(f HookFunc) (Unregister, error) {
+	return c.addHook(unhandledEvent, f)
+}
+
+func (c *Contract) addHook(event Event, f HookFunc) (Unregister, error) {
+	if c.IsClose.Load() {
+		return nil, errors.New("already closed, Registration of event hook is prohibited")
+	}
+	if f == nil {
+		return nil, errors.New("event hook is nil")
+	}
+	c.mu.Lock()
+	id := c.handleFunc.add(event, f)
+	c.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			c.handleFunc.remove(event, id)
+			c.mu.Unlock()
+		})
+	}, nil
+}
+
+// Use middlewares of every Hook, they wrap the middlewares of UseEvent,
+// the first middleware is the outermost, e.g.
+//
+//	c.Use(Logging(logger), SkipToDeadLetter(store), Retry(3, time.Second), Timeout(10*time.Second), Recover())
+func (c *Contract) Use(mws ...Middleware) error {
+	if c.IsClose.Load() {
+		return errors.New("already closed, Registration of middleware is prohibited")
+	}
+	c.mu.Lock()
+	c.middlewares = append(c.middlewares, mws...)
+	c.mu.Unlock()
+	return nil
+}
+
+// UseEvent middlewares of the hooks of event, or of the catch-all hooks if event is AnyEvent,
+// the first middleware is the outermost
+func (c *Contract) UseEvent(event Event, mws ...Middleware) error {
 	if c.IsClose.Load() {
-		return errors.New("already closed, Registration of event hook is prohibited")
+		return errors.New("already closed, Registration of middleware is prohibited")
 	}
 	c.mu.Lock()
-	c.handleFunc[event] = f
+	c.eventMiddlewares[event] = append(c.eventMiddlewares[event], mws...)
 	c.mu.Unlock()
 	return nil
 }
 
 // HandleEvent method call Hook
 func (c *Contract) HandleEvent(client *rpcclient.EvmClient, event Event, log types.Log) error {
+	return c.HandleEventContext(c.ctx, client, event, log)
+}
+
+// HandleEventContext method call the hooks of event in order with ctx, it stops at the first error
+func (c *Contract) HandleEventContext(ctx context.Context, client *rpcclient.EvmClient, event Event, log types.Log) error {
 	if !c.IsRunning.Load() {
 		return errors.New("not running, handle event is prohibited")
 	}
 
+	// hooks are called without the lock, they may register or unregister hooks
 	c.mu.RLock()
-	defer c.mu.RUnlock()
-	if f, ok := c.handleFunc[event]; ok {
-		return f(client, log)
+	key := event
+	if !c.handleFunc.has(event) {
+		key = unhandledEvent
+	}
+	hooks, catchAll := c.handleFunc.get(key), c.handleFunc.get(AnyEvent)
+	eventMws, anyMws, mws := c.eventMiddlewares[key], c.eventMiddlewares[AnyEvent], c.middlewares
+	c.mu.RUnlock()
+
+	for _, f := range hooks {
+		if err := c.runHook(ctx, client, event, log, Chain(Chain(f, eventMws...), mws...)); err != nil {
+			return err
+		}
+	}
+	for _, f := range catchAll {
+		if err := c.runHook(ctx, client, event, log, Chain(Chain(f, anyMws...), mws...)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// runHook reports the metrics and the span of the hook
+func (c *Contract) runHook(ctx context.Context, client *rpcclient.EvmClient, event Event, log types.Log, f HookFunc) error {
+	ctx, span := c.tracer.Start(ctx, tracing.HookSpan, trace.WithAttributes(
+		tracing.EventKey.String(event.String()),
+		tracing.ContractKey.String(log.Address.Hex()),
+		tracing.BlockNumberKey.Int64(int64(log.BlockNumber)),
+		tracing.TxHashKey.String(log.TxHash.Hex()),
+		tracing.LogIndexKey.Int(int(log.Index)),
+	))
+	start := time.Now()
+	err := f(ctx, client, log)
+	metrics.Default().Hook(metrics.ChainLabel(c.Chain, c.ChainId), c.watcher, event.String(), time.Since(start), err)
+	tracing.End(span, err)
+	return err
+}
+
 // UpdateProcessedBlockNumber ...
 func (c *Contract) UpdateProcessedBlockNumber(num uint64) error {
 	c.mu.Lock()
@@ -158,12 +345,9 @@ func (c *Contract) GetProcessedBlockNumber() uint64 {
 	return c.ProcessedBlockNumber
 }
 
-func (c *Contract) GetContractDesc(addr string) (ContractDesc, error) {
-	v, ok := c.ContractToDesc[addr]
-	if !ok {
-		return ContractDesc{}, errors.New("not found")
-	}
-	return v, nil
+// logger with the chain fields, ChainId may be set after Init
+func (c *Contract) logger() *slog.Logger {
+	return c.Logger.With("chain_id", c.ChainId, "chain", c.Chain)
 }
 
 func (e Event) String() string {
@@ -0,0 +1,124 @@
+package abs
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/AcSunday/gwatch-chain/tracing"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// selectors of name(), symbol() and decimals()
+var (
+	nameSelector     = []byte{0x06, 0xfd, 0xde, 0x03}
+	symbolSelector   = []byte{0x95, 0xd8, 0x9b, 0x41}
+	decimalsSelector = []byte{0x31, 0x3c, 0xe5, 0x67}
+)
+
+// GetContractDesc key is the checksum address
+func (c *Contract) GetContractDesc(addr string) (ContractDesc, error) {
+	c.mu.RLock()
+	v, ok := c.ContractToDesc[addr]
+	c.mu.RUnlock()
+	if !ok {
+		return ContractDesc{}, errors.New("not found")
+	}
+	return v, nil
+}
+
+// discoverContracts fetches the name, symbol and decimals of the contracts first seen in logs into ContractToDesc,
+// it is best effort, the contract without any of them is not fetched again
+func (c *Contract) discoverContracts(ctx context.Context, client *rpcclient.EvmClient, logs []types.Log) {
+	c.mu.RLock()
+	var addrs []common.Address
+	seen := make(map[common.Address]struct{})
+	for _, l := range logs {
+		if _, ok := seen[l.Address]; ok {
+			continue
+		}
+		seen[l.Address] = struct{}{}
+		_, known := c.ContractToDesc[l.Address.String()]
+		_, failed := c.undiscoverable[l.Address]
+		if !known && !failed {
+			addrs = append(addrs, l.Address)
+		}
+	}
+	c.mu.RUnlock()
+	if len(addrs) == 0 {
+		return
+	}
+
+	// name, symbol and decimals of every contract in a batch
+	selectors := [][]byte{nameSelector, symbolSelector, decimalsSelector}
+	msgs := make([]ethereum.CallMsg, 0, len(addrs)*len(selectors))
+	for _, addr := range addrs {
+		for _, selector := range selectors {
+			msgs = append(msgs, ethereum.CallMsg{To: &addr, Data: selector})
+		}
+	}
+	ctx, span := tracing.StartRPC(ctx, c.tracer, client.GetRawUrl(), "eth_call")
+	outs, errs, err := client.CallContracts(ctx, msgs, nil)
+	tracing.End(span, err)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, addr := range addrs {
+		desc, ok := contractDesc(outs[i*3:i*3+3], errs[i*3:i*3+3])
+		if ok {
+			c.ContractToDesc[addr.String()] = desc
+		} else {
+			c.undiscoverable[addr] = struct{}{}
+		}
+		c.logger().Debug("contract discovered", "contract", addr, "name", desc.Name, "symbol", desc.Symbol,
+			"decimals", desc.Decimals, "ok", ok)
+	}
+}
+
+// contractDesc outputs of name, symbol and decimals, false if the contract has none of them
+func contractDesc(outs [][]byte, errs []error) (ContractDesc, bool) {
+	var (
+		desc ContractDesc
+		ok   bool
+	)
+	if errs[0] == nil && len(outs[0]) > 0 {
+		desc.Name, ok = decodeString(outs[0]), true
+	}
+	if errs[1] == nil && len(outs[1]) > 0 {
+		desc.Symbol, ok = decodeString(outs[1]), true
+	}
+	if errs[2] == nil && len(outs[2]) >= 32 {
+		n := new(big.Int).SetBytes(outs[2][:32])
+		if n.IsUint64() && n.Uint64() <= 255 {
+			desc.Decimals, ok = uint8(n.Uint64()), true
+		}
+	}
+	return desc, ok
+}
+
+// decodeString abi encoded string, or bytes32 of the early tokens
+func decodeString(out []byte) string {
+	if len(out) == 32 {
+		return strings.TrimRight(string(out), "\x00")
+	}
+	if len(out) < 64 {
+		return ""
+	}
+	offset := new(big.Int).SetBytes(out[:32])
+	if !offset.IsUint64() || offset.Uint64()+32 > uint64(len(out)) {
+		return ""
+	}
+	start := offset.Uint64() + 32
+	size := new(big.Int).SetBytes(out[start-32 : start])
+	if !size.IsUint64() || start+size.Uint64() > uint64(len(out)) {
+		return ""
+	}
+	return string(out[start : start+size.Uint64()])
+}
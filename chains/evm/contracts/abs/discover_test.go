@@ -0,0 +1,106 @@
+package abs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func abiString(s string) []byte {
+	out := common.LeftPadBytes([]byte{32}, 32)
+	out = append(out, common.LeftPadBytes([]byte{byte(len(s))}, 32)...)
+	return append(out, common.RightPadBytes([]byte(s), 32)...)
+}
+
+func TestAnyContract(t *testing.T) {
+	tokenA, tokenB := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(120)
+	node.SetMaxLogs(3)
+	for n := uint64(101); n <= 110; n++ {
+		l := transferLog(n, 0)
+		l.Address = tokenA
+		node.AddLogs(l)
+	}
+	l := transferLog(102, 1)
+	l.Address = tokenB
+	node.AddLogs(l)
+	node.SetCallResult(tokenA, nameSelector, abiString("Tether USD"))
+	node.SetCallResult(tokenA, symbolSelector, common.RightPadBytes([]byte("USDT"), 32))
+	node.SetCallResult(tokenA, decimalsSelector, common.LeftPadBytes([]byte{6}, 32))
+	client := node.Client(t)
+
+	c := newTestContract(nil, Attrs{ChainId: 56, ProcessedBlockNumber: 100, WatchBlockLimit: 10, AnyContract: true, DiscoverContracts: true})
+	defer c.Close()
+	if err := c.Scan(client); err == nil {
+		t.Fatal("expected error without topic filters")
+	}
+
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+	// 101..111, 101..106 and 101..103 exceed 3 logs, 101..102 is accepted
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetProcessedBlockNumber() != 102 || c.getBlockLimit() != 1 {
+		t.Fatalf("unexpected range: processed %d, limit %d", c.GetProcessedBlockNumber(), c.getBlockLimit())
+	}
+	// 103..104 is accepted, the range grows
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetProcessedBlockNumber() != 104 || c.getBlockLimit() != 3 {
+		t.Fatalf("unexpected range: processed %d, limit %d", c.GetProcessedBlockNumber(), c.getBlockLimit())
+	}
+
+	desc, err := c.GetContractDesc(tokenA.String())
+	if err != nil || desc != (ContractDesc{Name: "Tether USD", Symbol: "USDT", Decimals: 6}) {
+		t.Fatalf("unexpected desc: %+v, %v", desc, err)
+	}
+	if _, err = c.GetContractDesc(tokenB.String()); err == nil {
+		t.Fatal("contract without metadata is discovered")
+	}
+	if node.Calls("eth_call") != 6 {
+		t.Fatalf("expected the contracts are fetched once, got %d calls", node.Calls("eth_call"))
+	}
+}
+
+func TestAnyContractTransientError(t *testing.T) {
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(120)
+	node.SetMaxLogs(3)
+	for n := uint64(101); n <= 110; n++ {
+		node.AddLogs(transferLog(n, 0))
+	}
+	client := node.Client(t)
+
+	c := newTestContract(nil, Attrs{ChainId: 56, ProcessedBlockNumber: 100, WatchBlockLimit: 10, AnyContract: true})
+	defer c.Close()
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+
+	// a transient error does not shrink the range
+	node.FailNext("eth_getLogs", errors.New("connection reset by peer"))
+	if err := c.Scan(client); err == nil {
+		t.Fatal("expected the transient error")
+	}
+	if c.GetProcessedBlockNumber() != 100 || c.getBlockLimit() != 10 {
+		t.Fatalf("unexpected range: processed %d, limit %d", c.GetProcessedBlockNumber(), c.getBlockLimit())
+	}
+
+	// the range stops shrinking at 1
+	node.SetMaxLogs(1)
+	if err := c.Scan(client); err == nil {
+		t.Fatal("expected the range error")
+	}
+	if c.GetProcessedBlockNumber() != 100 || c.getBlockLimit() != 1 {
+		t.Fatalf("unexpected range: processed %d, limit %d", c.GetProcessedBlockNumber(), c.getBlockLimit())
+	}
+	node.SetMaxLogs(3)
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetProcessedBlockNumber() != 102 || c.getBlockLimit() != 3 {
+		t.Fatalf("unexpected range: processed %d, limit %d", c.GetProcessedBlockNumber(), c.getBlockLimit())
+	}
+}
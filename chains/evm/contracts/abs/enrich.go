@@ -0,0 +1,286 @@
+package abs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/AcSunday/gwatch-chain/tracing"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const enrichCacheSize = 1024 // entries of headers, transactions and receipts each
+
+type envelopeKey struct{}
+
+// WithEnvelope the envelope of the log passed to the hooks
+func WithEnvelope(ctx context.Context, e EventEnvelope) context.Context {
+	return context.WithValue(ctx, envelopeKey{}, e)
+}
+
+// EnvelopeFromContext the envelope of the log in a hook, with the block header, the transaction and the receipt
+// when enrichment is enabled, see Attrs.EnrichBlocks
+func EnvelopeFromContext(ctx context.Context) (EventEnvelope, bool) {
+	e, ok := ctx.Value(envelopeKey{}).(EventEnvelope)
+	return e, ok
+}
+
+// txWithSender transaction of the json-rpc response
+type txWithSender struct {
+	tx   *types.Transaction // nil if the type is not supported by go-ethereum
+	from common.Address
+}
+
+// rpcTxHeader the fields of the json-rpc transaction of any type
+type rpcTxHeader struct {
+	Hash common.Hash    `json:"hash"`
+	From common.Address `json:"from"`
+}
+
+// decode tx is nil when go-ethereum does not decode the type, like the deposit transaction of op chains
+func (t *txWithSender) decode(b []byte) error {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalJSON(b); err != nil {
+		return err
+	}
+	t.tx = tx
+	return nil
+}
+
+// enrichment headers, transactions and receipts of the logs of a range
+type enrichment struct {
+	headers  map[common.Hash]*types.Header // key is block hash
+	txs      map[common.Hash]*txWithSender // key is tx hash
+	receipts map[common.Hash]*types.Receipt
+}
+
+func newEnrichment() *enrichment {
+	return &enrichment{
+		headers:  make(map[common.Hash]*types.Header),
+		txs:      make(map[common.Hash]*txWithSender),
+		receipts: make(map[common.Hash]*types.Receipt),
+	}
+}
+
+func (en *enrichment) merge(o *enrichment) {
+	for k, v := range o.headers {
+		en.headers[k] = v
+	}
+	for k, v := range o.txs {
+		en.txs[k] = v
+	}
+	for k, v := range o.receipts {
+		en.receipts[k] = v
+	}
+}
+
+// fill sets the fields of the envelope
+func (en *enrichment) fill(e *EventEnvelope) {
+	if h, ok := en.headers[e.BlockHash]; ok {
+		e.Header = h
+		e.BlockTime = h.Time
+	}
+	if t, ok := en.txs[e.TxHash]; ok {
+		e.Tx, e.From = t.tx, t.from
+	}
+	e.Receipt = en.receipts[e.TxHash]
+}
+
+// boundedCache evicts the oldest entries
+type boundedCache[V any] struct {
+	m    map[common.Hash]V
+	keys []common.Hash
+}
+
+func (b *boundedCache[V]) get(k common.Hash) (V, bool) {
+	v, ok := b.m[k]
+	return v, ok
+}
+
+func (b *boundedCache[V]) put(k common.Hash, v V) {
+	if b.m == nil {
+		b.m = make(map[common.Hash]V)
+	}
+	if _, ok := b.m[k]; !ok {
+		b.keys = append(b.keys, k)
+	}
+	b.m[k] = v
+	for len(b.keys) > enrichCacheSize {
+		delete(b.m, b.keys[0])
+		b.keys = b.keys[1:]
+	}
+}
+
+// enrichCache the rescanned ranges, the backfills and the children do not fetch again
+type enrichCache struct {
+	headers  boundedCache[*types.Header]
+	txs      boundedCache[*txWithSender]
+	receipts boundedCache[*types.Receipt]
+	mu       sync.Mutex
+}
+
+func (c *Contract) enriching() bool {
+	return c.EnrichBlocks || c.EnrichTxs || c.EnrichReceipts
+}
+
+// enrich batch fetches the headers, the transactions and the receipts of the logs which are not cached,
+// the blocks are fetched with the transactions when Attrs.EnrichTxs is set
+func (c *Contract) enrich(ctx context.Context, client *rpcclient.EvmClient, logs []types.Log) (*enrichment, error) {
+	en := newEnrichment()
+	if !c.enriching() || len(logs) == 0 {
+		return en, nil
+	}
+
+	type block struct {
+		number uint64
+		hash   common.Hash
+		txs    []common.Hash // not cached
+	}
+	var (
+		blocks   []*block
+		byHash   = make(map[common.Hash]*block)
+		receipts []common.Hash // not cached
+	)
+	c.enrichCache.mu.Lock()
+	for _, l := range logs {
+		if l.Removed {
+			continue
+		}
+		b, ok := byHash[l.BlockHash]
+		if !ok {
+			b = &block{number: l.BlockNumber, hash: l.BlockHash}
+			byHash[l.BlockHash] = b
+			blocks = append(blocks, b)
+			if h, ok := c.enrichCache.headers.get(l.BlockHash); ok {
+				en.headers[l.BlockHash] = h
+			}
+		}
+		if _, ok := en.txs[l.TxHash]; c.EnrichTxs && !ok && !slices.Contains(b.txs, l.TxHash) {
+			if t, ok := c.enrichCache.txs.get(l.TxHash); ok {
+				en.txs[l.TxHash] = t
+			} else {
+				b.txs = append(b.txs, l.TxHash)
+			}
+		}
+		if _, ok := en.receipts[l.TxHash]; c.EnrichReceipts && !ok && !slices.Contains(receipts, l.TxHash) {
+			if r, ok := c.enrichCache.receipts.get(l.TxHash); ok {
+				en.receipts[l.TxHash] = r
+			} else {
+				receipts = append(receipts, l.TxHash)
+			}
+		}
+	}
+	c.enrichCache.mu.Unlock()
+	blocks = slices.DeleteFunc(blocks, func(b *block) bool {
+		_, cached := en.headers[b.hash]
+		return len(b.txs) == 0 && (cached || !c.EnrichBlocks)
+	})
+
+	// blocks, fetched by hash, the block of the number may be reorged
+	elems := make([]rpc.BatchElem, len(blocks))
+	results := make([]*json.RawMessage, len(blocks))
+	for i, b := range blocks {
+		results[i] = new(json.RawMessage)
+		elems[i] = rpc.BatchElem{Method: "eth_getBlockByHash", Args: []any{b.hash, c.EnrichTxs}, Result: results[i]}
+	}
+	if err := c.batchCall(ctx, client, elems); err != nil {
+		return nil, err
+	}
+	for i, b := range blocks {
+		if len(*results[i]) == 0 || string(*results[i]) == "null" {
+			return nil, fmt.Errorf("block %d %s not found", b.number, b.hash.Hex())
+		}
+		header := new(types.Header)
+		if err := json.Unmarshal(*results[i], header); err != nil {
+			return nil, fmt.Errorf("decode block %d failed, %v", b.number, err)
+		}
+		en.headers[b.hash] = header
+		if len(b.txs) == 0 {
+			continue
+		}
+		var body struct {
+			Txs []json.RawMessage `json:"transactions"`
+		}
+		if err := json.Unmarshal(*results[i], &body); err != nil {
+			return nil, fmt.Errorf("decode block %d failed, %v", b.number, err)
+		}
+		// only the transactions of the logs are decoded
+		for _, raw := range body.Txs {
+			var h rpcTxHeader
+			if err := json.Unmarshal(raw, &h); err != nil {
+				return nil, fmt.Errorf("decode transaction of block %d failed, %v", b.number, err)
+			}
+			if !slices.Contains(b.txs, h.Hash) {
+				continue
+			}
+			t := &txWithSender{from: h.From}
+			if err := t.decode(raw); err != nil {
+				c.logger().Warn("decode transaction failed, the envelope has no transaction",
+					"block_number", b.number, "tx_hash", h.Hash, "err", err)
+			}
+			en.txs[h.Hash] = t
+		}
+	}
+
+	// receipts
+	if len(receipts) > 0 {
+		rpcCtx, span := tracing.StartRPC(ctx, c.tracer, client.GetRawUrl(), "eth_getTransactionReceipt")
+		found, errs, err := client.TransactionReceipts(rpcCtx, receipts)
+		if err == nil {
+			err = firstError(errs, func(i int) string { return receipts[i].Hex() })
+		}
+		tracing.End(span, err)
+		if err != nil {
+			return nil, fmt.Errorf("get receipt failed, %v", err)
+		}
+		for i, hash := range receipts {
+			en.receipts[hash] = found[i]
+		}
+	}
+
+	c.enrichCache.mu.Lock()
+	for k, v := range en.headers {
+		c.enrichCache.headers.put(k, v)
+	}
+	for k, v := range en.txs {
+		c.enrichCache.txs.put(k, v)
+	}
+	for k, v := range en.receipts {
+		c.enrichCache.receipts.put(k, v)
+	}
+	c.enrichCache.mu.Unlock()
+	return en, nil
+}
+
+// batchCall fails if any call failed, see rpcclient.EvmClient.BatchCall
+func (c *Contract) batchCall(ctx context.Context, client *rpcclient.EvmClient, elems []rpc.BatchElem) error {
+	if len(elems) == 0 {
+		return nil
+	}
+	ctx, span := tracing.StartRPC(ctx, c.tracer, client.GetRawUrl(), elems[0].Method)
+	err := client.BatchCall(ctx, elems)
+	if err == nil {
+		errs := make([]error, len(elems))
+		for i, e := range elems {
+			errs[i] = e.Error
+		}
+		err = firstError(errs, func(i int) string { return fmt.Sprintf("%s %v", elems[i].Method, elems[i].Args[0]) })
+	}
+	tracing.End(span, err)
+	return err
+}
+
+// firstError the first error of a batch with the name of the item
+func firstError(errs []error, name func(i int) string) error {
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%s, %v", name(i), err)
+		}
+	}
+	return nil
+}
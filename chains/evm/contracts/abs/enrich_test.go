@@ -0,0 +1,119 @@
+package abs
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestScanEnrich(t *testing.T) {
+	sender := common.HexToAddress("0x5e")
+	txs := []evmtest.Tx{
+		{Transaction: types.NewTransaction(1, testToken, new(big.Int), 60000, big.NewInt(1), nil), From: sender, GasUsed: 50000},
+		{Transaction: types.NewTransaction(2, testToken, new(big.Int), 60000, big.NewInt(1), nil), From: sender, GasUsed: 40000},
+	}
+	logs := []types.Log{transferLog(101, 0), transferLog(101, 1), transferLog(103, 0)}
+	logs[0].TxHash, logs[1].TxHash, logs[2].TxHash = txs[0].Hash(), txs[0].Hash(), txs[1].Hash()
+	for i := range logs {
+		logs[i].BlockHash = evmtest.BlockHash(logs[i].BlockNumber)
+	}
+
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(110)
+	node.AddTxs(101, txs[0])
+	node.AddTxs(103, txs[1])
+	// the unrelated transaction of an unsupported type is not decoded
+	node.AddUnknownTx(101, common.Hash{0xde})
+	node.AddLogs(logs...)
+	client := node.Client(t)
+
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100,
+		EnrichBlocks: true, EnrichTxs: true, EnrichReceipts: true})
+	defer c.Close()
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+	fail := errors.New("db down")
+	var envelopes []EventEnvelope
+	c.RegisterEventHookContext(Event(testTransfer.Hex()), func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		if fail != nil {
+			err := fail
+			fail = nil
+			return err
+		}
+		e, ok := EnvelopeFromContext(ctx)
+		if !ok {
+			t.Fatal("envelope not found")
+		}
+		envelopes = append(envelopes, e)
+		return nil
+	})
+
+	if err := c.Scan(client); err == nil {
+		t.Fatal("expected hook error")
+	}
+	// the rescanned range is cached
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if node.Calls("eth_getBlockByHash") != 2 || node.Calls("eth_getTransactionReceipt") != 2 {
+		t.Fatalf("unexpected calls: %d blocks, %d receipts", node.Calls("eth_getBlockByHash"), node.Calls("eth_getTransactionReceipt"))
+	}
+	if node.Calls(evmtest.BatchCalls) != 2 {
+		t.Fatalf("expected a batch of blocks and a batch of receipts, got %d", node.Calls(evmtest.BatchCalls))
+	}
+	if len(envelopes) != 3 {
+		t.Fatalf("unexpected envelopes: %d", len(envelopes))
+	}
+	for i, e := range envelopes {
+		if e.BlockTime != evmtest.BlockTime(logs[i].BlockNumber) || e.Header.Number.Uint64() != logs[i].BlockNumber {
+			t.Fatalf("unexpected block of log %d: %d", i, e.BlockTime)
+		}
+		if e.Tx.Hash() != logs[i].TxHash || e.From != sender || e.Receipt.TxHash != logs[i].TxHash {
+			t.Fatalf("unexpected transaction of log %d: %+v", i, e)
+		}
+	}
+	if envelopes[2].Receipt.GasUsed != 40000 || envelopes[2].Tx.Nonce() != 2 {
+		t.Fatalf("unexpected receipt: %+v", envelopes[2].Receipt)
+	}
+}
+
+func TestScanEnrichUnknownTx(t *testing.T) {
+	deposit := common.Hash{0xde}
+	l := transferLog(101, 0)
+	l.BlockHash, l.TxHash = evmtest.BlockHash(101), deposit
+	reorged := transferLog(102, 0)
+
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(110)
+	node.AddUnknownTx(101, deposit)
+	node.AddLogs(l)
+	client := node.Client(t)
+
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100, EnrichTxs: true})
+	defer c.Close()
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+	var envelopes []EventEnvelope
+	c.RegisterEventHookContext(Event(testTransfer.Hex()), func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		e, _ := EnvelopeFromContext(ctx)
+		envelopes = append(envelopes, e)
+		return nil
+	})
+
+	// the transaction of the log is not decoded, the envelope has the sender only
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if len(envelopes) != 1 || envelopes[0].Tx != nil || envelopes[0].Header.Number.Uint64() != 101 {
+		t.Fatalf("unexpected envelopes: %+v", envelopes)
+	}
+
+	// the block of the log is reorged
+	if _, err := c.enrich(context.Background(), client, []types.Log{reorged}); err == nil {
+		t.Fatal("expected the block of the log is not found")
+	}
+}
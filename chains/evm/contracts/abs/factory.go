@@ -0,0 +1,140 @@
+package abs
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Child contract created by a factory, e.g. the pair of Uniswap V2 PairCreated
+type Child struct {
+	Address    common.Address
+	Factory    common.Address // the contract emitted the creation event
+	StartBlock uint64         // the block of the creation event, the child is watched from it
+	TxHash     common.Hash
+}
+
+// FactoryFunc returns the children created by the factory event log
+type FactoryFunc func(log types.Log) ([]common.Address, error)
+
+// RegisterFactory the children returned by f are watched from the block of the event in the same getLogs calls as their parent,
+// the logs of the children in the rest of the scanned range are handled in the same Scan,
+// they are reported in Batch.Children for the sinks to persist, restore them by AddChildren after restart
+func (c *Contract) RegisterFactory(event Event, f FactoryFunc) error {
+	if f == nil {
+		return errors.New("factory func is nil")
+	}
+	_, err := c.AddEventHook(event, func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		addrs, err := f(log)
+		if err != nil {
+			return err
+		}
+		return c.WatchChildren(ctx, log, addrs...)
+	})
+	return err
+}
+
+// WatchChildren declares the children created by the factory log in a Hook, see RegisterFactory,
+// the children join the watched addresses on the next Scan if ctx is not the context of Scan
+func (c *Contract) WatchChildren(ctx context.Context, factory types.Log, addrs ...common.Address) error {
+	children := make([]Child, 0, len(addrs))
+	for _, addr := range addrs {
+		children = append(children, Child{Address: addr, Factory: factory.Address, StartBlock: factory.BlockNumber, TxHash: factory.TxHash})
+	}
+	if col, ok := ctx.Value(childrenKey{}).(*childCollector); ok {
+		col.add(children)
+		return nil
+	}
+	for _, child := range children {
+		if err := c.AddAddresses(child.StartBlock, child.Address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddChildren restores the children persisted by the sinks, they are watched immediately without backfill,
+// because the persisted checkpoint is not behind their start blocks
+func (c *Contract) AddChildren(children ...Child) error {
+	if c.IsClose.Load() {
+		return errors.New("already closed, adding children is prohibited")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addChildrenLocked(children)
+	return nil
+}
+
+// addChildrenLocked returns the children which are not watched yet
+func (c *Contract) addChildrenLocked(children []Child) []Child {
+	var added []Child
+	addrs := slices.Clone(c.Addrs)
+	for _, child := range children {
+		if slices.Contains(addrs, child.Address) {
+			continue
+		}
+		addrs = append(addrs, child.Address)
+		if child.StartBlock > c.ProcessedBlockNumber+1 {
+			c.addrStart[child.Address] = child.StartBlock
+		}
+		added = append(added, child)
+	}
+	c.Addrs = addrs
+	return added
+}
+
+type childrenKey struct{}
+
+// childCollector children declared by the hooks of a log
+type childCollector struct {
+	mu       sync.Mutex
+	children []Child
+}
+
+func (col *childCollector) add(children []Child) {
+	col.mu.Lock()
+	col.children = append(col.children, children...)
+	col.mu.Unlock()
+}
+
+func (col *childCollector) take() []Child {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	children := col.children
+	col.children = nil
+	return children
+}
+
+// watchChildren the new children join the tail, returns their logs in [start block, toBlock],
+// the children found in a backfill range are backfilled
+func (c *Contract) watchChildren(ctx context.Context, client *rpcclient.EvmClient, children []Child, toBlock uint64, backfill bool) ([]types.Log, error) {
+	if backfill {
+		for _, child := range children {
+			if err := c.AddAddresses(child.StartBlock, child.Address); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	added := c.addChildrenLocked(children)
+	c.mu.Unlock()
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	addrs := make([]common.Address, len(added))
+	from := added[0].StartBlock
+	for i, child := range added {
+		addrs[i] = child.Address
+		from = min(from, child.StartBlock)
+	}
+	c.logger().Info("children discovered", "factory", added[0].Factory, "children", addrs, "start_block", from)
+	return c.filterLogs(ctx, client, c.filterQuery(addrs, int64(from), int64(toBlock)))
+}
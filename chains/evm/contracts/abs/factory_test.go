@@ -0,0 +1,78 @@
+package abs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestFactory(t *testing.T) {
+	pairCreated := crypto.Keccak256Hash([]byte("PairCreated(address,address,address,uint256)"))
+	pair := common.HexToAddress("0xc1")
+	childLog := func(block uint64, index uint) types.Log {
+		l := transferLog(block, index)
+		l.Address = pair
+		return l
+	}
+
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(120)
+	node.AddLogs(
+		childLog(101, 0), // before the creation
+		types.Log{Address: testToken, Topics: []common.Hash{pairCreated}, Data: common.LeftPadBytes(pair.Bytes(), 32),
+			BlockNumber: 103, TxHash: common.Hash{103}, Index: 1},
+		childLog(103, 2),
+		childLog(110, 0),
+	)
+	client := node.Client(t)
+
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100})
+	defer c.Close()
+	sink := &testSink{}
+	c.RegisterSink(sink)
+	c.RegisterWatchEvent(Event(testTransfer.Hex()), Event(pairCreated.Hex()))
+	c.RegisterFactory(Event(pairCreated.Hex()), func(log types.Log) ([]common.Address, error) {
+		return []common.Address{common.BytesToAddress(log.Data)}, nil
+	})
+	var seen []string
+	c.AddEventHook(AnyEvent, func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		seen = append(seen, fmt.Sprintf("%s@%d", log.Address.Hex()[:4], log.BlockNumber))
+		return nil
+	})
+
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(seen) != "[0x55@103 0x00@103 0x00@110]" {
+		t.Fatalf("unexpected logs: %v", seen)
+	}
+	batch := sink.batches[0]
+	if len(batch.Children) != 1 || batch.Children[0].Address != pair || batch.Children[0].StartBlock != 103 || len(batch.Events) != 3 {
+		t.Fatalf("unexpected batch: %+v", batch)
+	}
+
+	// the child is scanned in the same getLogs call as its parent
+	node.SetLatest(130)
+	node.AddLogs(childLog(125, 0))
+	calls := node.Calls("eth_getLogs")
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if node.Calls("eth_getLogs") != calls+1 || seen[len(seen)-1] != "0x00@125" {
+		t.Fatalf("unexpected logs: %v", seen)
+	}
+
+	// restored after restart
+	restarted := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 130})
+	defer restarted.Close()
+	restarted.AddChildren(batch.Children...)
+	if len(restarted.Addresses()) != 2 {
+		t.Fatalf("unexpected addresses: %v", restarted.Addresses())
+	}
+}
@@ -0,0 +1,253 @@
+package abs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// topicSet topics of a eth_getLogs, empty position is wildcard
+type topicSet [4][]common.Hash
+
+// Filter composes the topic constraints per event, see RegisterFilter
+//
+//	f := NewFilter()
+//	f.Event(transfer).Address(2, depositAddrs...)
+//	f.Event(approval).Address(1, owner)
+type Filter struct {
+	events []*EventFilter
+}
+
+// EventFilter the topic constraints of an event, the values of a position are matched by any,
+// the positions are matched by all
+type EventFilter struct {
+	event  common.Hash
+	topics [3][]common.Hash // indexed parameters [1-3]
+	err    error
+}
+
+func NewFilter() *Filter {
+	return &Filter{}
+}
+
+// Event adds the constraints of event, an event added twice matches any of its constraints
+func (f *Filter) Event(event Event) *EventFilter {
+	e := &EventFilter{event: common.HexToHash(event.String())}
+	f.events = append(f.events, e)
+	return e
+}
+
+// Topic indexed parameter of the event, index: [1-3]
+func (e *EventFilter) Topic(index int, topics ...common.Hash) *EventFilter {
+	if e.err != nil {
+		return e
+	}
+	if index < 1 || index > 3 {
+		e.err = fmt.Errorf("invalid topic index %d of event %s, the indexed parameters are [1-3]", index, e.event)
+		return e
+	}
+	if len(topics) == 0 {
+		e.err = fmt.Errorf("no topics at index %d of event %s", index, e.event)
+		return e
+	}
+	e.topics[index-1] = append(e.topics[index-1], topics...)
+	return e
+}
+
+// Address indexed address parameter, the address is left padded to 32 bytes
+func (e *EventFilter) Address(index int, addrs ...common.Address) *EventFilter {
+	topics := make([]common.Hash, 0, len(addrs))
+	for _, addr := range addrs {
+		topics = append(topics, common.BytesToHash(addr.Bytes()))
+	}
+	return e.Topic(index, topics...)
+}
+
+// Uint indexed uint parameter, e.g. the token id of ERC721 Transfer
+func (e *EventFilter) Uint(index int, values ...*big.Int) *EventFilter {
+	topics := make([]common.Hash, 0, len(values))
+	for _, v := range values {
+		if v == nil || v.Sign() < 0 || v.BitLen() > 256 {
+			e.err = fmt.Errorf("invalid uint %v at index %d of event %s", v, index, e.event)
+			return e
+		}
+		topics = append(topics, common.BigToHash(v))
+	}
+	return e.Topic(index, topics...)
+}
+
+// Compile the topics of the minimal eth_getLogs queries matching exactly the constraints
+func (f *Filter) Compile() ([][][]common.Hash, error) {
+	sets, err := f.topicSets()
+	if err != nil {
+		return nil, err
+	}
+	compiled := make([][][]common.Hash, 0, len(sets))
+	for _, set := range sets {
+		compiled = append(compiled, set.topics())
+	}
+	return compiled, nil
+}
+
+func (f *Filter) topicSets() ([]topicSet, error) {
+	if len(f.events) == 0 {
+		return nil, errors.New("no events in the filter")
+	}
+	sets := make([]topicSet, 0, len(f.events))
+	for _, e := range f.events {
+		if e.err != nil {
+			return nil, e.err
+		}
+		set := topicSet{{e.event}}
+		for i, topics := range e.topics {
+			set[i+1] = topics
+		}
+		sets = append(sets, set)
+	}
+	return compactTopics(sets), nil
+}
+
+// RegisterFilter watches the events of the filter besides RegisterWatchEvent and RegisterWatchTopics,
+// the events are fetched by the minimal set of queries, see Filter.Compile
+func (c *Contract) RegisterFilter(f *Filter) error {
+	if c.IsClose.Load() {
+		return errors.New("already closed, Registration of filters is prohibited")
+	}
+	sets, err := f.topicSets()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.filters = compactTopics(append(c.filters, sets...))
+	c.mu.Unlock()
+	return nil
+}
+
+// topicSets the topics of the queries of a range, legacy is the topics of RegisterWatchEvent and RegisterWatchTopics
+func (c *Contract) topicSets(legacy [][]common.Hash) [][][]common.Hash {
+	c.mu.RLock()
+	filters := c.filters
+	c.mu.RUnlock()
+	if len(filters) == 0 {
+		return [][][]common.Hash{legacy}
+	}
+
+	sets := slices.Clone(filters)
+	var set topicSet
+	copy(set[:], legacy)
+	if !set.wildcard() {
+		sets = compactTopics(append([]topicSet{set}, sets...))
+	}
+	topics := make([][][]common.Hash, 0, len(sets))
+	for _, set := range sets {
+		topics = append(topics, set.topics())
+	}
+	return topics
+}
+
+// compactTopics merges the sets which differ in one position and removes the subsumed sets,
+// the union of the merged sets is the same
+func compactTopics(sets []topicSet) []topicSet {
+	res := make([]topicSet, 0, len(sets))
+	for _, set := range sets {
+		var s topicSet
+		for i, topics := range set {
+			s[i] = normalizeTopics(topics)
+		}
+		res = append(res, s)
+	}
+
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(res) && !merged; i++ {
+			for j := i + 1; j < len(res) && !merged; j++ {
+				if s, ok := mergeTopicSets(res[i], res[j]); ok {
+					res[i] = s
+					res = slices.Delete(res, j, j+1)
+					merged = true
+				}
+			}
+		}
+	}
+	return res
+}
+
+// mergeTopicSets the union of a and b if it is a topic set
+func mergeTopicSets(a, b topicSet) (topicSet, bool) {
+	switch {
+	case a.covers(b):
+		return a, true
+	case b.covers(a):
+		return b, true
+	}
+	diff := -1
+	for i := range a {
+		if !slices.Equal(a[i], b[i]) {
+			if diff >= 0 {
+				return topicSet{}, false
+			}
+			diff = i
+		}
+	}
+	// a[diff] and b[diff] are not wildcard, otherwise one covers the other
+	a[diff] = normalizeTopics(append(slices.Clone(a[diff]), b[diff]...))
+	return a, true
+}
+
+// covers every log matched by o is matched by s
+func (s topicSet) covers(o topicSet) bool {
+	for i := range s {
+		if len(s[i]) == 0 {
+			continue
+		}
+		if len(o[i]) == 0 {
+			return false
+		}
+		for _, t := range o[i] {
+			if _, ok := slices.BinarySearchFunc(s[i], t, compareHash); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s topicSet) wildcard() bool {
+	for _, topics := range s {
+		if len(topics) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// topics trailing wildcard positions are trimmed
+func (s topicSet) topics() [][]common.Hash {
+	n := len(s)
+	for n > 0 && len(s[n-1]) == 0 {
+		n--
+	}
+	topics := make([][]common.Hash, n)
+	for i := range topics {
+		topics[i] = slices.Clone(s[i])
+	}
+	return topics
+}
+
+func normalizeTopics(topics []common.Hash) []common.Hash {
+	if len(topics) == 0 {
+		return nil
+	}
+	topics = slices.Clone(topics)
+	slices.SortFunc(topics, compareHash)
+	return slices.Compact(topics)
+}
+
+func compareHash(a, b common.Hash) int {
+	return bytes.Compare(a[:], b[:])
+}
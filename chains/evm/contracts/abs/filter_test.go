@@ -0,0 +1,114 @@
+package abs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var testApproval = crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))
+
+func TestFilterCompile(t *testing.T) {
+	a, b := common.HexToAddress("0xa"), common.HexToAddress("0xb")
+	topicA, topicB := common.BytesToHash(a.Bytes()), common.BytesToHash(b.Bytes())
+
+	cases := []struct {
+		name  string
+		build func(f *Filter)
+		want  string
+	}{
+		{"same event", func(f *Filter) {
+			f.Event(Event(testTransfer.Hex())).Address(2, a)
+			f.Event(Event(testTransfer.Hex())).Address(2, b, a)
+		}, fmt.Sprint([][][]common.Hash{{{testTransfer}, nil, {topicA, topicB}}})},
+		{"same constraint", func(f *Filter) {
+			f.Event(Event(testTransfer.Hex())).Address(2, a)
+			f.Event(Event(testApproval.Hex())).Address(2, a)
+		}, fmt.Sprint([][][]common.Hash{{{testApproval, testTransfer}, nil, {topicA}}})},
+		{"subsumed", func(f *Filter) {
+			f.Event(Event(testTransfer.Hex())).Address(1, a).Address(2, b)
+			f.Event(Event(testTransfer.Hex())).Address(2, b)
+		}, fmt.Sprint([][][]common.Hash{{{testTransfer}, nil, {topicB}}})},
+		{"per event", func(f *Filter) {
+			f.Event(Event(testTransfer.Hex())).Address(2, a)
+			f.Event(Event(testApproval.Hex())).Address(1, a)
+		}, fmt.Sprint([][][]common.Hash{{{testTransfer}, nil, {topicA}}, {{testApproval}, {topicA}}})},
+	}
+	for _, tc := range cases {
+		f := NewFilter()
+		tc.build(f)
+		topics, err := f.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(topics) != tc.want {
+			t.Fatalf("%s: unexpected topics %v", tc.name, topics)
+		}
+	}
+
+	f := NewFilter()
+	f.Event(Event(testTransfer.Hex())).Address(4, a)
+	if _, err := f.Compile(); err == nil {
+		t.Fatal("expected invalid index error")
+	}
+}
+
+func TestRegisterWatchTopics(t *testing.T) {
+	c := newTestContract([]common.Address{testToken}, Attrs{})
+	defer c.Close()
+	if err := c.RegisterWatchTopics(-1, common.Hash{1}); err == nil {
+		t.Fatal("expected invalid index error")
+	}
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+	if err := c.RegisterWatchEvent(Event(testApproval.Hex()), Event(testTransfer.Hex())); err != nil {
+		t.Fatal(err)
+	}
+	c.RegisterWatchTopics(2, common.Hash{2})
+	query := c.filterQuery(nil, 1, 2)
+	if len(query.Topics) != 3 || len(query.Topics[0]) != 2 || query.Topics[1] != nil || len(query.Topics[2]) != 1 {
+		t.Fatalf("unexpected topics: %v", query.Topics)
+	}
+}
+
+func TestScanFilter(t *testing.T) {
+	deposit := common.HexToAddress("0xd")
+	transfer := func(block uint64, to common.Address) types.Log {
+		l := transferLog(block, 0)
+		l.Topics[2] = common.BytesToHash(to.Bytes())
+		return l
+	}
+	approval := transfer(105, common.Address{})
+	approval.Topics = []common.Hash{testApproval, common.BytesToHash(deposit.Bytes()), {}}
+
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(110)
+	node.AddLogs(transfer(101, deposit), transfer(102, common.Address{1}), transfer(103, deposit), approval)
+	client := node.Client(t)
+
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100})
+	defer c.Close()
+	f := NewFilter()
+	f.Event(Event(testTransfer.Hex())).Address(2, deposit)
+	f.Event(Event(testApproval.Hex())).Address(1, deposit)
+	if err := c.RegisterFilter(f); err != nil {
+		t.Fatal(err)
+	}
+	var blocks []uint64
+	c.AddEventHook(AnyEvent, func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		blocks = append(blocks, log.BlockNumber)
+		return nil
+	})
+
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(blocks) != "[101 103 105]" || node.Calls("eth_getLogs") != 2 {
+		t.Fatalf("unexpected logs %v of %d queries", blocks, node.Calls("eth_getLogs"))
+	}
+}
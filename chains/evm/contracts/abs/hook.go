@@ -0,0 +1,99 @@
+package abs
+
+import (
+	"context"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// HookFunc context-aware Hook, ctx is cancelled when the contract is closed,
+// it carries the span of the hook and the ScanInfo of the scan cycle
+type HookFunc func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error
+
+// AdaptHook the Hook without context as a HookFunc
+func AdaptHook(f func(client *rpcclient.EvmClient, log types.Log) error) HookFunc {
+	return func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		return f(client, log)
+	}
+}
+
+// ScanInfo metadata of the scan cycle which calls the Hook
+type ScanInfo struct {
+	ChainId     uint64
+	Chain       string
+	FromBlock   uint64
+	ToBlock     uint64
+	LatestBlock uint64
+	Node        string // scheme://host of the rpc node, see metrics.NodeLabel
+	Backfill    bool   // the range of the addresses added by AddAddresses
+}
+
+type scanInfoKey struct{}
+
+// WithScanInfo returns a copy of ctx carrying info
+func WithScanInfo(ctx context.Context, info ScanInfo) context.Context {
+	return context.WithValue(ctx, scanInfoKey{}, info)
+}
+
+// ScanInfoFromContext the ScanInfo of the scan cycle, false if the Hook is not called by Scan
+func ScanInfoFromContext(ctx context.Context) (ScanInfo, bool) {
+	info, ok := ctx.Value(scanInfoKey{}).(ScanInfo)
+	return info, ok
+}
+
+// AnyEvent the catch-all Hook of AddEventHook, it is called for every event after the hooks of the event
+const AnyEvent Event = "*"
+
+// unhandledEvent key of the hooks of AddUnhandledEventHook
+const unhandledEvent Event = ""
+
+// Unregister removes the Hook, calling it again has no effect
+type Unregister func()
+
+type hookEntry struct {
+	id uint64
+	f  HookFunc
+}
+
+// hookRegistry ordered hooks by event, guarded by Contract.mu
+type hookRegistry struct {
+	seq     uint64
+	entries map[Event][]hookEntry
+}
+
+func (r *hookRegistry) add(event Event, f HookFunc) uint64 {
+	if r.entries == nil {
+		r.entries = make(map[Event][]hookEntry, 4)
+	}
+	r.seq++
+	r.entries[event] = append(r.entries[event], hookEntry{id: r.seq, f: f})
+	return r.seq
+}
+
+func (r *hookRegistry) remove(event Event, id uint64) {
+	entries := r.entries[event]
+	for i, e := range entries {
+		if e.id == id {
+			r.entries[event] = append(entries[:i:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(r.entries[event]) == 0 {
+		delete(r.entries, event)
+	}
+}
+
+// get copy of the hooks of event
+func (r *hookRegistry) get(event Event) []HookFunc {
+	entries := r.entries[event]
+	fs := make([]HookFunc, len(entries))
+	for i, e := range entries {
+		fs[i] = e.f
+	}
+	return fs
+}
+
+func (r *hookRegistry) has(event Event) bool {
+	return len(r.entries[event]) > 0
+}
@@ -0,0 +1,46 @@
+package abs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestEventHooks(t *testing.T) {
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56})
+	defer c.Close()
+
+	var calls []string
+	hook := func(name string) HookFunc {
+		return func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	transfer, approval := Event(testTransfer.Hex()), Event("0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925")
+	c.RegisterEventHookContext(transfer, hook("first"))
+	unregister, _ := c.AddEventHook(transfer, hook("second"))
+	c.AddEventHook(AnyEvent, hook("any"))
+	c.AddUnhandledEventHook(hook("unhandled"))
+
+	assertCalls := func(event Event, expected string) {
+		t.Helper()
+		calls = nil
+		if err := c.HandleEvent(nil, event, types.Log{}); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(calls, ",") != expected {
+			t.Fatalf("event %s, unexpected calls: %v", event, calls)
+		}
+	}
+	assertCalls(transfer, "first,second,any")
+	assertCalls(approval, "unhandled,any")
+
+	unregister()
+	unregister()
+	assertCalls(transfer, "first,any")
+}
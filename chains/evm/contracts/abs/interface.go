@@ -1,6 +1,8 @@
 package abs
 
 import (
+	"context"
+
 	"github.com/AcSunday/gwatch-chain/rpcclient"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -12,8 +14,24 @@ type IContract interface {
 	DoneSignal() <-chan struct{}
 	RegisterWatchEvent(events ...Event) error
 	RegisterWatchTopics(topicsIndex int, topics ...common.Hash) error
+	RegisterFilter(f *Filter) error
+	AddAddresses(startBlock uint64, addrs ...common.Address) error
+	RemoveAddresses(addrs ...common.Address) error
+	Addresses() []common.Address
+	RegisterFactory(event Event, f FactoryFunc) error
+	AddChildren(children ...Child) error
 	RegisterEventHook(event Event, f func(client *rpcclient.EvmClient, log types.Log) error) error
+	RegisterEventHookContext(event Event, f HookFunc) error
+	AddEventHook(event Event, f HookFunc) (Unregister, error)
+	AddUnhandledEventHook(f HookFunc) (Unregister, error)
+	Use(mws ...Middleware) error
+	UseEvent(event Event, mws ...Middleware) error
 	HandleEvent(client *rpcclient.EvmClient, event Event, log types.Log) error
+	HandleEventContext(ctx context.Context, client *rpcclient.EvmClient, event Event, log types.Log) error
+	RegisterSink(s Sink) error
+	RegisterDecoder(d Decoder) error
+	Events() <-chan EventEnvelope
+	Ack(e EventEnvelope) error
 	UpdateProcessedBlockNumber(num uint64) error
 	GetProcessedBlockNumber() uint64
 	Scan(client *rpcclient.EvmClient) error
@@ -0,0 +1,181 @@
+package abs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Middleware wraps a Hook, see Contract.Use and Contract.UseEvent
+type Middleware func(next HookFunc) HookFunc
+
+// Chain wraps f with mws, the first middleware is the outermost
+func Chain(f HookFunc, mws ...Middleware) HookFunc {
+	for i := len(mws) - 1; i >= 0; i-- {
+		f = mws[i](f)
+	}
+	return f
+}
+
+// PanicError the panic of a Hook recovered by Recover
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("hook panicked, %v", e.Value)
+}
+
+// Recover converts the panic of the Hook into a *PanicError
+func Recover() Middleware {
+	return func(next HookFunc) HookFunc {
+		return func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+			return next(ctx, client, log)
+		}
+	}
+}
+
+// Timeout cancels ctx of the Hook after d, and returns context.DeadlineExceeded
+// without waiting for the Hook which ignores ctx, the Hook keeps running in the background
+func Timeout(d time.Duration) Middleware {
+	return func(next HookFunc) HookFunc {
+		return func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			type result struct {
+				err   error
+				panic any
+			}
+			done := make(chan result, 1)
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						done <- result{panic: r}
+					}
+				}()
+				done <- result{err: next(ctx, client, log)}
+			}()
+
+			select {
+			case res := <-done:
+				if res.panic != nil {
+					panic(res.panic)
+				}
+				return res.err
+			case <-ctx.Done():
+				return fmt.Errorf("hook timeout after %v, %w", d, ctx.Err())
+			}
+		}
+	}
+}
+
+// Retry calls the Hook up to attempts times, the backoff doubles after each failure,
+// it stops when ctx is done
+func Retry(attempts int, backoff time.Duration) Middleware {
+	return func(next HookFunc) HookFunc {
+		return func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+			var err error
+			wait := backoff
+			for i := 0; i < max(attempts, 1); i++ {
+				if i > 0 {
+					select {
+					case <-ctx.Done():
+						return errors.Join(err, ctx.Err())
+					case <-time.After(wait):
+					}
+					wait *= 2
+				}
+				err = next(ctx, client, log)
+				if err == nil || ctx.Err() != nil {
+					return err
+				}
+			}
+			return err
+		}
+	}
+}
+
+// DeadLetter the log skipped by the DeadLetter middleware
+type DeadLetter struct {
+	Event Event
+	Log   types.Log
+	Err   error
+	Time  time.Time
+}
+
+type DeadLetterStore interface {
+	Put(ctx context.Context, d DeadLetter) error
+}
+
+// DeadLetterFunc adapts a function to DeadLetterStore
+type DeadLetterFunc func(ctx context.Context, d DeadLetter) error
+
+func (f DeadLetterFunc) Put(ctx context.Context, d DeadLetter) error {
+	return f(ctx, d)
+}
+
+// SkipToDeadLetter records the failed log to store and skips it, so the range is not scanned again,
+// the error is returned if store failed or the contract is closed
+func SkipToDeadLetter(store DeadLetterStore) Middleware {
+	return func(next HookFunc) HookFunc {
+		return func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+			err := next(ctx, client, log)
+			if err == nil {
+				return nil
+			}
+			if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+				return err
+			}
+
+			var event Event
+			if len(log.Topics) > 0 {
+				event = Event(log.Topics[0].Hex())
+			}
+			if perr := store.Put(ctx, DeadLetter{Event: event, Log: log, Err: err, Time: time.Now()}); perr != nil {
+				return fmt.Errorf("put dead letter failed, %v, hook error: %w", perr, err)
+			}
+			return nil
+		}
+	}
+}
+
+// Logging logs the failed Hook at warn level and the succeeded Hook at debug level
+func Logging(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next HookFunc) HookFunc {
+		return func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+			start := time.Now()
+			err := next(ctx, client, log)
+			attrs := []any{"contract", log.Address, "block_number", log.BlockNumber, "tx_hash", log.TxHash,
+				"log_index", log.Index, "duration", time.Since(start)}
+			if len(log.Topics) > 0 {
+				attrs = append(attrs, "event", log.Topics[0])
+			}
+			if err != nil {
+				var perr *PanicError
+				if errors.As(err, &perr) {
+					attrs = append(attrs, "stack", string(perr.Stack))
+				}
+				logger.WarnContext(ctx, "hook failed", append(attrs, "err", err)...)
+				return err
+			}
+			logger.DebugContext(ctx, "hook succeeded", attrs...)
+			return nil
+		}
+	}
+}
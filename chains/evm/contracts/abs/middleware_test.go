@@ -0,0 +1,102 @@
+package abs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next HookFunc) HookFunc {
+			return func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+				calls = append(calls, name)
+				return next(ctx, client, log)
+			}
+		}
+	}
+	f := Chain(func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		calls = append(calls, "hook")
+		return nil
+	}, mw("a"), mw("b"))
+
+	if err := f(context.Background(), nil, types.Log{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, ",") != "a,b,hook" {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+func TestScanDeadLetter(t *testing.T) {
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(120)
+	node.AddLogs(transferLog(101, 0), transferLog(102, 0))
+	client := node.Client(t)
+
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100})
+	defer c.Close()
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+
+	var (
+		calls   int
+		letters []DeadLetter
+	)
+	c.Use(SkipToDeadLetter(DeadLetterFunc(func(ctx context.Context, d DeadLetter) error {
+		letters = append(letters, d)
+		return nil
+	})), Retry(3, time.Millisecond), Recover())
+	c.RegisterEventHook(Event(testTransfer.Hex()), func(client *rpcclient.EvmClient, log types.Log) error {
+		calls++
+		if log.BlockNumber == 101 {
+			panic("bad log")
+		}
+		return nil
+	})
+
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 4 {
+		t.Fatalf("expected 3 attempts of the bad log and 1 of the good log, got %d", calls)
+	}
+	var perr *PanicError
+	if len(letters) != 1 || letters[0].Log.BlockNumber != 101 || !errors.As(letters[0].Err, &perr) {
+		t.Fatalf("unexpected dead letters: %+v", letters)
+	}
+	if c.GetProcessedBlockNumber() != 120 {
+		t.Fatalf("unexpected processed block number: %d", c.GetProcessedBlockNumber())
+	}
+}
+
+func TestScanEventTimeout(t *testing.T) {
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(120)
+	node.AddLogs(transferLog(101, 0))
+	client := node.Client(t)
+
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100})
+	defer c.Close()
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+	c.UseEvent(Event(testTransfer.Hex()), Timeout(10*time.Millisecond))
+	c.RegisterEventHookContext(Event(testTransfer.Hex()), func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := c.Scan(client)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if c.GetProcessedBlockNumber() != 100 {
+		t.Fatalf("unexpected processed block number: %d", c.GetProcessedBlockNumber())
+	}
+}
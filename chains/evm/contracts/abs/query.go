@@ -0,0 +1,142 @@
+package abs
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/AcSunday/gwatch-chain/tracing"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	DefaultMaxQueryAddresses = 500
+	DefaultMaxQueryTopics    = 500
+	DefaultQueryConcurrency  = 4
+)
+
+// filterLogs the query is split by the topics of the filters, see RegisterFilter,
+// and sharded when the addresses or the topics of a position exceed the max per query,
+// the shards are executed concurrently, the logs are merged in order of (block number, log index),
+// the logs are filtered from the block receipts in ScanReceipts mode, or fetched by the registered LogSource
+func (c *Contract) filterLogs(ctx context.Context, client *rpcclient.EvmClient, query ethereum.FilterQuery) ([]types.Log, error) {
+	c.mu.RLock()
+	src := c.logSource
+	c.mu.RUnlock()
+	if src != nil {
+		return c.sourceLogs(ctx, client, src, query)
+	}
+	if c.ScanMode == ScanReceipts {
+		return c.receiptLogs(ctx, client, query)
+	}
+
+	var shards []ethereum.FilterQuery
+	for _, topics := range c.topicSets(query.Topics) {
+		q := query
+		q.Topics = topics
+		shards = append(shards, shardQuery(q, c.MaxQueryAddresses, c.MaxQueryTopics)...)
+	}
+	if len(shards) == 1 {
+		return c.getLogs(ctx, client, shards[0])
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		logs     []types.Log
+		firstErr error
+		sem      = make(chan struct{}, c.QueryConcurrency)
+	)
+	for _, q := range shards {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(q ethereum.FilterQuery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res, err := c.getLogs(ctx, client, q)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			logs = append(logs, res...)
+		}(q)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return mergeLogs(logs), nil
+}
+
+func (c *Contract) getLogs(ctx context.Context, client *rpcclient.EvmClient, query ethereum.FilterQuery) ([]types.Log, error) {
+	ctx, span := tracing.StartRPC(ctx, c.tracer, client.GetRawUrl(), "eth_getLogs")
+	logs, err := client.FilterLogs(ctx, query)
+	tracing.End(span, err)
+	return logs, err
+}
+
+// shardQuery splits the addresses and the topics of every position into chunks, the shards are the cross product
+func shardQuery(query ethereum.FilterQuery, maxAddrs, maxTopics int) []ethereum.FilterQuery {
+	shards := []ethereum.FilterQuery{query}
+	if maxAddrs > 0 && len(query.Addresses) > maxAddrs {
+		shards = shards[:0]
+		for addrs := range slices.Chunk(query.Addresses, maxAddrs) {
+			q := query
+			q.Addresses = addrs
+			shards = append(shards, q)
+		}
+	}
+
+	for i, topics := range query.Topics {
+		if maxTopics <= 0 || len(topics) <= maxTopics {
+			continue
+		}
+		next := make([]ethereum.FilterQuery, 0, len(shards)*(len(topics)+maxTopics-1)/maxTopics)
+		for _, shard := range shards {
+			for chunk := range slices.Chunk(topics, maxTopics) {
+				q := shard
+				q.Topics = slices.Clone(shard.Topics)
+				q.Topics[i] = chunk
+				next = append(next, q)
+			}
+		}
+		shards = next
+	}
+	return shards
+}
+
+// mergeLogs sorts the logs by (block number, log index) and removes the duplicates
+func mergeLogs(logs []types.Log) []types.Log {
+	slices.SortFunc(logs, func(a, b types.Log) int {
+		if a.BlockNumber != b.BlockNumber {
+			return cmp.Compare(a.BlockNumber, b.BlockNumber)
+		}
+		return cmp.Compare(a.Index, b.Index)
+	})
+	type key struct {
+		block common.Hash
+		index uint
+	}
+	seen := make(map[key]struct{}, len(logs))
+	return slices.DeleteFunc(logs, func(l types.Log) bool {
+		k := key{l.BlockHash, l.Index}
+		if _, ok := seen[k]; ok {
+			return true
+		}
+		seen[k] = struct{}{}
+		return false
+	})
+}
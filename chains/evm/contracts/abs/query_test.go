@@ -0,0 +1,73 @@
+package abs
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestShardQuery(t *testing.T) {
+	addrs := make([]common.Address, 5)
+	for i := range addrs {
+		addrs[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	to := []common.Hash{{1}, {2}, {3}}
+	query := ethereum.FilterQuery{Addresses: addrs, Topics: [][]common.Hash{{testTransfer}, nil, to}}
+
+	shards := shardQuery(query, 2, 2)
+	if len(shards) != 6 {
+		t.Fatalf("expected 3 address shards x 2 topic shards, got %d", len(shards))
+	}
+	for _, q := range shards {
+		if len(q.Addresses) > 2 || len(q.Topics[2]) > 2 || q.Topics[0][0] != testTransfer {
+			t.Fatalf("unexpected shard: %+v", q)
+		}
+	}
+	if shards[0].Topics[2][0] != to[0] || shards[1].Topics[2][0] != to[2] {
+		t.Fatal("topics of the query are modified")
+	}
+	if len(shardQuery(query, 0, 0)) != 1 {
+		t.Fatal("unlimited query is sharded")
+	}
+}
+
+func TestScanShards(t *testing.T) {
+	addrs := make([]common.Address, 5)
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(110)
+	for i := range addrs {
+		addrs[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+		// the later addresses have the earlier logs
+		l := transferLog(uint64(110-i), uint(i))
+		l.Address = addrs[i]
+		node.AddLogs(l)
+	}
+	client := node.Client(t)
+
+	c := newTestContract(addrs, Attrs{ChainId: 56, ProcessedBlockNumber: 100, MaxQueryAddresses: 2})
+	defer c.Close()
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+	var blocks []uint64
+	c.RegisterEventHookContext(Event(testTransfer.Hex()), func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		blocks = append(blocks, log.BlockNumber)
+		return nil
+	})
+
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if node.Calls("eth_getLogs") != 3 {
+		t.Fatalf("expected 3 shards, got %d", node.Calls("eth_getLogs"))
+	}
+	for i, n := range []uint64{106, 107, 108, 109, 110} {
+		if blocks[i] != n {
+			t.Fatalf("unexpected order: %v", blocks)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package abs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/AcSunday/gwatch-chain/tracing"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ScanMode how the logs of a block range are fetched
+type ScanMode int
+
+const (
+	ScanLogs ScanMode = iota // eth_getLogs, default
+	// ScanReceipts the receipts of every block by eth_getBlockReceipts, or by the transactions when it is not supported,
+	//  the logs are filtered locally, for the nodes with broken or rate limited eth_getLogs
+	ScanReceipts
+)
+
+// receiptLogs the logs of the receipts of the blocks in the query matching the addresses and the topics
+func (c *Contract) receiptLogs(ctx context.Context, client *rpcclient.EvmClient, query ethereum.FilterQuery) ([]types.Log, error) {
+	from, to := query.FromBlock.Uint64(), query.ToBlock.Uint64()
+	ctx, span := tracing.StartRPC(ctx, c.tracer, client.GetRawUrl(), "eth_getBlockReceipts")
+	receipts, errs, err := client.BlockReceiptsByRange(ctx, from, to)
+	if err == nil {
+		err = firstError(errs, func(i int) string { return fmt.Sprintf("block %d", from+uint64(i)) })
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := c.topicSets(query.Topics)
+	var logs []types.Log
+	for _, block := range receipts {
+		for _, r := range block {
+			for _, l := range r.Logs {
+				if matchLog(*l, query.Addresses, sets) {
+					logs = append(logs, *l)
+				}
+			}
+		}
+	}
+	return mergeLogs(logs), nil
+}
+
+// matchLog same as the filter of eth_getLogs, the log matches any of the topic sets
+func matchLog(l types.Log, addrs []common.Address, sets [][][]common.Hash) bool {
+	if len(addrs) > 0 && !slices.Contains(addrs, l.Address) {
+		return false
+	}
+	return slices.ContainsFunc(sets, func(topics [][]common.Hash) bool {
+		if len(topics) > len(l.Topics) {
+			return false
+		}
+		for i, sub := range topics {
+			if len(sub) > 0 && !slices.Contains(sub, l.Topics[i]) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// LogSource fetches the logs of the query instead of eth_getLogs, e.g. the synthetic logs of the native transfers,
+// the logs of query.Addresses are returned, the topics are filtered by the contract
+type LogSource func(ctx context.Context, client *rpcclient.EvmClient, query ethereum.FilterQuery) ([]types.Log, error)
+
+// RegisterLogSource the logs of every range, the backfills and the children are fetched by src,
+// the hooks, the sinks and the checkpoint are the same as the contract logs
+func (c *Contract) RegisterLogSource(src LogSource) error {
+	if c.IsClose.Load() {
+		return errors.New("already closed, Registration of log source is prohibited")
+	}
+	if src == nil {
+		return errors.New("log source is nil")
+	}
+	c.mu.Lock()
+	c.logSource = src
+	c.mu.Unlock()
+	return nil
+}
+
+// sourceLogs the logs of the registered source matching the topics
+func (c *Contract) sourceLogs(ctx context.Context, client *rpcclient.EvmClient, src LogSource, query ethereum.FilterQuery) ([]types.Log, error) {
+	logs, err := src(ctx, client, query)
+	if err != nil {
+		return nil, err
+	}
+	sets := c.topicSets(query.Topics)
+	logs = slices.DeleteFunc(logs, func(l types.Log) bool {
+		return !matchLog(l, nil, sets)
+	})
+	return mergeLogs(logs), nil
+}
@@ -0,0 +1,60 @@
+package abs
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestScanReceipts(t *testing.T) {
+	for _, blockReceipts := range []bool{true, false} {
+		var txs []evmtest.Tx
+		for i := range 3 {
+			txs = append(txs, evmtest.Tx{Transaction: types.NewTransaction(uint64(i), testToken, new(big.Int), 60000, big.NewInt(1), nil)})
+		}
+		other := transferLog(101, 1)
+		other.Address, other.TxHash = common.HexToAddress("0x0a"), txs[1].Hash()
+		approval := transferLog(103, 0)
+		approval.Topics[0], approval.TxHash = testApproval, txs[2].Hash()
+		transfers := []types.Log{transferLog(101, 0), transferLog(101, 2)}
+		transfers[0].TxHash, transfers[1].TxHash = txs[0].Hash(), txs[1].Hash()
+
+		node := evmtest.NewNode(t, 56)
+		node.SetLatest(110)
+		node.AddTxs(101, txs[0], txs[1])
+		node.AddTxs(103, txs[2])
+		node.AddLogs(other, approval, transfers[1], transfers[0])
+		if !blockReceipts {
+			node.DisableMethod("eth_getBlockReceipts")
+		}
+		client := node.Client(t)
+
+		c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100, ScanMode: ScanReceipts})
+		c.RegisterWatchEvent(Event(testTransfer.Hex()))
+		var seen []string
+		c.AddEventHook(AnyEvent, func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+			seen = append(seen, fmt.Sprintf("%d/%d", log.BlockNumber, log.Index))
+			return nil
+		})
+
+		if err := c.Scan(client); err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+		if fmt.Sprint(seen) != "[101/0 101/2]" || c.GetProcessedBlockNumber() != 110 {
+			t.Fatalf("block receipts %v: unexpected logs %v, processed %d", blockReceipts, seen, c.GetProcessedBlockNumber())
+		}
+		if node.Calls("eth_getLogs") != 0 {
+			t.Fatal("eth_getLogs is called")
+		}
+		if !blockReceipts && node.Calls("eth_getTransactionReceipt") != 3 {
+			t.Fatalf("expected the receipts of 3 transactions, got %d", node.Calls("eth_getTransactionReceipt"))
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package abs
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AcSunday/gwatch-chain/tracing"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// log index keyspaces of the synthetic logs made by the log sources, the real log indexes are below them,
+// so the synthetic logs do not collide with the real logs of the same transaction
+const (
+	NativeLogIndexBase uint = 1 << 30 // native transfers, base + position of the transfer in the block
+	CallLogIndexBase   uint = 1 << 31 // calls, base + transaction index
+)
+
+// EventEnvelope normalized event of a log
+type EventEnvelope struct {
+	ChainId     uint64
+	Chain       string
+	Contract    common.Address
+	Event       Event // topics[0]
+	BlockNumber uint64
+	BlockHash   common.Hash
+	BlockTime   uint64 // unix seconds, set by Events or Attrs.EnrichBlocks
+	TxHash      common.Hash
+	TxIndex     uint
+	LogIndex    uint
+	Decoded     any       // decoded by the registered Decoder, nil if not decoded
+	Log         types.Log // raw log
+
+	Header  *types.Header      // set by Attrs.EnrichBlocks
+	Tx      *types.Transaction // set by Attrs.EnrichTxs, nil if the type is not supported by go-ethereum
+	From    common.Address     // sender of Tx
+	Receipt *types.Receipt     // set by Attrs.EnrichReceipts
+}
+
+// Batch events of a scanned block range [FromBlock, ToBlock]
+type Batch struct {
+	ChainId   uint64
+	Chain     string
+	FromBlock uint64
+	ToBlock   uint64 // the processed block number after the batch is acknowledged
+	Events    []EventEnvelope
+	Children  []Child // declared by the factory hooks in the range, see RegisterFactory
+}
+
+// Sink receives the events of every scanned range, a batch without events is also written,
+// the processed block number is updated only after all sinks return nil,
+// a failed batch is scanned and written again, so the events are delivered at least once
+type Sink interface {
+	// Write returns nil when the batch is stored durably
+	Write(ctx context.Context, batch *Batch) error
+	Close() error
+}
+
+// NewEventEnvelope the envelope without BlockTime and Decoded
+func NewEventEnvelope(attrs Attrs, log types.Log) EventEnvelope {
+	var event Event
+	if len(log.Topics) > 0 {
+		event = Event(log.Topics[0].Hex())
+	}
+	return EventEnvelope{
+		ChainId:     attrs.ChainId,
+		Chain:       attrs.Chain,
+		Contract:    log.Address,
+		Event:       event,
+		BlockNumber: log.BlockNumber,
+		BlockHash:   log.BlockHash,
+		TxHash:      log.TxHash,
+		TxIndex:     log.TxIndex,
+		LogIndex:    log.Index,
+		Log:         log,
+	}
+}
+
+// RegisterSink the batch of every scanned range is written to the sinks in order of registration,
+// the sinks are closed when the contract is closed
+func (c *Contract) RegisterSink(s Sink) error {
+	if c.IsClose.Load() {
+		return errors.New("already closed, Registration of sink is prohibited")
+	}
+	if s == nil {
+		return errors.New("sink is nil")
+	}
+	c.mu.Lock()
+	c.sinks = append(c.sinks, s)
+	c.mu.Unlock()
+	return nil
+}
+
+// writeSinks returns nil when all sinks acknowledged the batch
+func (c *Contract) writeSinks(ctx context.Context, batch *Batch) error {
+	c.mu.RLock()
+	sinks := c.sinks
+	c.mu.RUnlock()
+
+	ctx, span := c.tracer.Start(ctx, tracing.SinkSpan, trace.WithAttributes(
+		tracing.FromBlockKey.Int64(int64(batch.FromBlock)),
+		tracing.ToBlockKey.Int64(int64(batch.ToBlock)),
+		tracing.LogsKey.Int(len(batch.Events)),
+	))
+	var err error
+	for _, s := range sinks {
+		if err = s.Write(ctx, batch); err != nil {
+			break
+		}
+	}
+	tracing.End(span, err)
+	return err
+}
+
+func (c *Contract) hasSinks() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.sinks) > 0
+}
+
+func (c *Contract) closeSinks() error {
+	c.mu.RLock()
+	sinks := c.sinks
+	c.mu.RUnlock()
+
+	var errs []error
+	for _, s := range sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,203 @@
+package abs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const DefaultEventBuffer = 256
+
+type eventKey struct {
+	txHash   common.Hash
+	logIndex uint
+}
+
+// streamRange events of a scanned range which are not acknowledged
+type streamRange struct {
+	toBlock  uint64
+	backfill bool // the range of the added addresses, it does not move the processed block number
+	pending  map[eventKey]struct{}
+}
+
+// Events streams the events of every scanned range in order, the buffer size is Attrs.EventBuffer,
+// the first call switches the contract to streaming mode:
+// the processed block number is updated by Ack instead of Scan, a range is processed after all of its events are acknowledged,
+// Scan keeps scanning ahead until the buffer is full, the unacknowledged events are delivered again after restart.
+// The channel is closed when the contract is closed, see DoneSignal
+func (c *Contract) Events() <-chan EventEnvelope {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	if c.events == nil {
+		size := c.EventBuffer
+		if size <= 0 {
+			size = DefaultEventBuffer
+		}
+		c.events = make(chan EventEnvelope, size)
+		c.scannedBlockNumber = c.GetProcessedBlockNumber()
+	}
+	if c.IsClose.Load() {
+		c.closeEventsLocked()
+	}
+	return c.events
+}
+
+// Ack acknowledges the event received from Events
+func (c *Contract) Ack(e EventEnvelope) error {
+	if !c.isStreaming() {
+		return errors.New("not streaming, call Events first")
+	}
+
+	c.ackMu.Lock()
+	defer c.ackMu.Unlock()
+	key := eventKey{txHash: e.TxHash, logIndex: e.LogIndex}
+	found := false
+	for _, r := range c.streamRanges {
+		if _, ok := r.pending[key]; ok {
+			delete(r.pending, key)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("event tx %s log %d is not pending", e.TxHash, e.LogIndex)
+	}
+	c.advanceLocked()
+	return nil
+}
+
+// Decoder decodes the log into EventEnvelope.Decoded, returns nil if the log is not decoded
+type Decoder func(log types.Log) any
+
+// RegisterDecoder the decoder of EventEnvelope.Decoded, the standard contracts register their own decoder
+func (c *Contract) RegisterDecoder(d Decoder) error {
+	if c.IsClose.Load() {
+		return errors.New("already closed, Registration of decoder is prohibited")
+	}
+	c.mu.Lock()
+	c.decoder = d
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Contract) decode(log types.Log) any {
+	c.mu.RLock()
+	d := c.decoder
+	c.mu.RUnlock()
+	if d == nil {
+		return nil
+	}
+	return d(log)
+}
+
+func (c *Contract) isStreaming() bool {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	return c.events != nil
+}
+
+// scanFrom the next block number to scan
+func (c *Contract) scanFrom() uint64 {
+	processed := c.GetProcessedBlockNumber()
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	if c.events != nil && c.scannedBlockNumber > processed {
+		return c.scannedBlockNumber + 1
+	}
+	return processed + 1
+}
+
+// publish sends the events of the range to the channel, blocks when the buffer is full
+func (c *Contract) publish(ctx context.Context, client *rpcclient.EvmClient, batch *Batch, backfill bool) error {
+	// block time of the blocks which have events, unless enriched
+	times := make(map[uint64]uint64)
+	for i := range batch.Events {
+		e := &batch.Events[i]
+		if e.BlockTime != 0 {
+			continue
+		}
+		t, ok := times[e.BlockNumber]
+		if !ok {
+			header, err := c.headerByNumber(ctx, client, e.BlockNumber)
+			if err != nil {
+				return fmt.Errorf("get block %d header failed, %v", e.BlockNumber, err)
+			}
+			t = header.Time
+			times[e.BlockNumber] = t
+		}
+		e.BlockTime = t
+	}
+
+	r := &streamRange{toBlock: batch.ToBlock, backfill: backfill, pending: make(map[eventKey]struct{}, len(batch.Events))}
+	for _, e := range batch.Events {
+		r.pending[eventKey{txHash: e.TxHash, logIndex: e.LogIndex}] = struct{}{}
+	}
+	c.ackMu.Lock()
+	c.streamRanges = append(c.streamRanges, r)
+	c.ackMu.Unlock()
+
+	// sendMu prevents the channel from being closed while sending
+	c.sendMu.Lock()
+	for _, e := range batch.Events {
+		if c.IsClose.Load() {
+			c.sendMu.Unlock()
+			return errors.New("already closed")
+		}
+		select {
+		case c.events <- e:
+		case <-c.ctx.Done():
+			c.sendMu.Unlock()
+			return c.ctx.Err()
+		}
+	}
+	c.sendMu.Unlock()
+
+	if !backfill {
+		c.streamMu.Lock()
+		c.scannedBlockNumber = batch.ToBlock
+		c.streamMu.Unlock()
+	}
+
+	c.ackMu.Lock()
+	c.advanceLocked()
+	c.ackMu.Unlock()
+	return nil
+}
+
+// advanceLocked updates the processed block number to the last range whose events are all acknowledged
+func (c *Contract) advanceLocked() {
+	n, processed := 0, uint64(0)
+	for n < len(c.streamRanges) && len(c.streamRanges[n].pending) == 0 {
+		if !c.streamRanges[n].backfill {
+			processed = c.streamRanges[n].toBlock
+		}
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	if processed > 0 {
+		c.UpdateProcessedBlockNumber(processed)
+	}
+	c.streamRanges = c.streamRanges[n:]
+}
+
+func (c *Contract) closeEvents() {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	c.closeEventsLocked()
+}
+
+func (c *Contract) closeEventsLocked() {
+	if c.events == nil || c.eventsClosed {
+		return
+	}
+	c.sendMu.Lock()
+	close(c.events)
+	c.eventsClosed = true
+	c.sendMu.Unlock()
+}
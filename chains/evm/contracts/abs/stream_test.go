@@ -0,0 +1,54 @@
+package abs
+
+import (
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestEvents(t *testing.T) {
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(120)
+	node.AddLogs(transferLog(101, 0), transferLog(103, 1), transferLog(105, 0))
+	client := node.Client(t)
+
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100, WatchBlockLimit: 2, EventBuffer: 4})
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+	c.RegisterDecoder(func(log types.Log) any { return log.Index })
+
+	events := c.Events()
+	if err := c.Ack(EventEnvelope{}); err == nil {
+		t.Fatal("expected error of unknown event")
+	}
+
+	// scan ahead of the processed block number
+	for i := 0; i < 2; i++ {
+		if err := c.Scan(client); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.GetProcessedBlockNumber() != 100 {
+		t.Fatalf("processed block number moved to %d before ack", c.GetProcessedBlockNumber())
+	}
+
+	expected := []uint64{100, 103, 106}
+	for i, processed := range expected {
+		e := <-events
+		if e.BlockTime != evmtest.BlockTime(e.BlockNumber) || e.Decoded != e.LogIndex || e.ChainId != 56 {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+		if err := c.Ack(e); err != nil {
+			t.Fatal(err)
+		}
+		if c.GetProcessedBlockNumber() != processed {
+			t.Fatalf("event %d, expected processed block number %d, got %d", i, processed, c.GetProcessedBlockNumber())
+		}
+	}
+
+	c.Close()
+	if _, ok := <-events; ok {
+		t.Fatal("expected closed channel")
+	}
+}
@@ -2,72 +2,290 @@ package abs
 
 import (
 	"context"
-	"github.com/AcSunday/gwatch-chain/rpcclient"
-	"github.com/ethereum/go-ethereum"
+	"errors"
 	"math/big"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/AcSunday/gwatch-chain/metrics"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/AcSunday/gwatch-chain/tracing"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (c *Contract) Scan(client *rpcclient.EvmClient) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, span := c.tracer.Start(c.ctx, tracing.ScanSpan, trace.WithAttributes(
+		tracing.ChainIdKey.Int64(int64(c.ChainId)),
+		tracing.ChainKey.String(c.Chain),
+	))
+	err := c.scan(ctx, client)
+	tracing.End(span, err)
+	return err
+}
+
+// scan ctx carries the span of the scan cycle
+func (c *Contract) scan(ctx context.Context, client *rpcclient.EvmClient) error {
+	rpcCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	// get latest block
-	latestNumber, err := client.BlockNumber(ctx)
+	latestNumber, err := c.blockNumber(rpcCtx, client)
 	if err != nil {
 		return err
 	}
-	if c.ProcessedBlockNumber+1 > latestNumber {
-		return nil
+	// scanned ahead of the processed block number in streaming mode
+	fromBlockNumber := c.scanFrom()
+	// the added addresses join the tail from fromBlockNumber, their history is backfilled
+	c.applyAddresses(fromBlockNumber - 1)
+	if fromBlockNumber > latestNumber {
+		c.reportScan(latestNumber, 0)
+		return c.backfill(ctx, client, latestNumber)
+	}
+
+	if c.AnyContract && !c.hasTopics() {
+		return errors.New("topic filters are required to watch any contract, see RegisterWatchEvent")
 	}
 
-	startBlockNumber := int64(c.ProcessedBlockNumber + 1)
-	endBlockNumber := startBlockNumber + c.WatchBlockLimit
+	startBlockNumber := int64(fromBlockNumber)
+	limit := c.getBlockLimit()
+	endBlockNumber := startBlockNumber + limit
 	if endBlockNumber > int64(latestNumber) {
 		endBlockNumber = int64(latestNumber)
 	}
 
 	// filter data on the chain
 	query := c.getFilterQuery(startBlockNumber, endBlockNumber)
-	logs, err := client.FilterLogs(ctx, query)
+	logs, err := c.filterLogs(rpcCtx, client, query)
+	// any contract mode: halve the range until the node accepts the query
+	shrunk := false
+	for err != nil && c.AnyContract && isRangeError(err) && endBlockNumber-startBlockNumber > 1 {
+		shrunk = true
+		limit = max((endBlockNumber-startBlockNumber)/2, 1)
+		c.logger().Warn("filter logs failed, shrink the block range", "node", metrics.NodeLabel(client.GetRawUrl()),
+			"from_block", startBlockNumber, "to_block", endBlockNumber, "block_limit", limit, "err", err)
+		endBlockNumber = startBlockNumber + limit
+		c.setBlockLimit(limit)
+		query = c.getFilterQuery(startBlockNumber, endBlockNumber)
+		logs, err = c.filterLogsTimeout(ctx, client, query)
+	}
 	if err != nil {
+		c.logger().Warn("filter logs failed", "node", metrics.NodeLabel(client.GetRawUrl()),
+			"from_block", startBlockNumber, "to_block", endBlockNumber, "err", err)
 		return err
 	}
+	if c.AnyContract && !shrunk {
+		// grow back after the range is accepted
+		c.setBlockLimit(min(limit*2+1, c.WatchBlockLimit))
+	}
+	if shrunk {
+		// the retries may use up the timeout of the range
+		rpcCtx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+	}
 
-	for _, l := range logs {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(tracing.FromBlockKey.Int64(startBlockNumber), tracing.ToBlockKey.Int64(endBlockNumber),
+		tracing.LogsKey.Int(len(logs)))
+	ctx = WithScanInfo(ctx, ScanInfo{
+		ChainId:     c.ChainId,
+		Chain:       c.Chain,
+		FromBlock:   uint64(startBlockNumber),
+		ToBlock:     uint64(endBlockNumber),
+		LatestBlock: latestNumber,
+		Node:        metrics.NodeLabel(client.GetRawUrl()),
+	})
+
+	batch := &Batch{
+		ChainId:   c.ChainId,
+		Chain:     c.Chain,
+		FromBlock: uint64(startBlockNumber),
+		ToBlock:   uint64(endBlockNumber),
+	}
+	err = c.handleLogs(ctx, rpcCtx, client, logs, batch, false)
+	if err != nil {
+		return err
+	}
+
+	c.logger().Debug("scanned block range", "from_block", startBlockNumber, "to_block", endBlockNumber,
+		"latest_block", latestNumber, "contracts", len(query.Addresses), "logs", len(logs))
+
+	// the processed block number is updated by Ack in streaming mode
+	if !c.isStreaming() {
+		c.UpdateProcessedBlockNumber(uint64(endBlockNumber))
+	}
+	c.reportScan(latestNumber, len(logs))
+	return c.backfill(ctx, client, latestNumber)
+}
+
+// handleLogs calls the hooks, writes the batch to the sinks and publishes it in streaming mode,
+// the logs of the added addresses before their start block are skipped,
+// the logs of the children declared by the hooks are fetched and handled in order
+func (c *Contract) handleLogs(ctx, rpcCtx context.Context, client *rpcclient.EvmClient, logs []types.Log, batch *Batch, backfill bool) error {
+	col := &childCollector{}
+	ctx = context.WithValue(ctx, childrenKey{}, col)
+	hasSinks, streaming := c.hasSinks(), c.isStreaming()
+	starts := c.addrStarts()
+	if c.DiscoverContracts {
+		discoverCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		c.discoverContracts(discoverCtx, client, logs)
+		cancel()
+	}
+	en, err := c.enrich(rpcCtx, client, logs)
+	if err != nil {
+		c.logger().Warn("enrich logs failed, the range is scanned again", "node", metrics.NodeLabel(client.GetRawUrl()),
+			"from_block", batch.FromBlock, "to_block", batch.ToBlock, "err", err)
+		return err
+	}
+	for i := 0; i < len(logs); i++ {
+		l := logs[i]
 		// filter not have topic, or has been reverted
 		if len(l.Topics) == 0 || l.Removed {
 			continue
 		}
+		if start, ok := starts[l.Address]; ok && l.BlockNumber < start {
+			continue
+		}
 
-		event := l.Topics[0]
-		err := c.HandleEvent(client, Event(event.Hex()), l)
+		e := NewEventEnvelope(Attrs{ChainId: c.ChainId, Chain: c.Chain}, l)
+		e.Decoded = c.decode(l)
+		en.fill(&e)
+		err = c.HandleEventContext(WithEnvelope(ctx, e), client, e.Event, l)
 		if err != nil {
+			c.logger().Warn("event hook failed, the range is scanned again",
+				"contract", l.Address, "event", e.Event, "block_number", l.BlockNumber, "tx_hash", l.TxHash, "log_index", l.Index, "err", err)
 			return err
 		}
+		if children := col.take(); len(children) > 0 {
+			batch.Children = append(batch.Children, children...)
+			more, err := c.watchChildren(rpcCtx, client, children, batch.ToBlock, backfill)
+			if err == nil {
+				var moreEn *enrichment
+				if moreEn, err = c.enrich(rpcCtx, client, more); err == nil {
+					en.merge(moreEn)
+				}
+			}
+			if err != nil {
+				c.logger().Warn("filter logs of children failed, the range is scanned again", "node", metrics.NodeLabel(client.GetRawUrl()),
+					"block_number", l.BlockNumber, "to_block", batch.ToBlock, "err", err)
+				return err
+			}
+			if len(more) > 0 {
+				logs = append(slices.Clone(logs[:i+1]), mergeLogs(append(slices.Clone(logs[i+1:]), more...))...)
+				starts = c.addrStarts()
+			}
+		}
+		if hasSinks || streaming {
+			batch.Events = append(batch.Events, e)
+		}
 	}
 
-	c.UpdateProcessedBlockNumber(uint64(endBlockNumber))
-
+	// commit the checkpoint after the sinks acknowledged
+	if hasSinks {
+		err = c.writeSinks(ctx, batch)
+		if err != nil {
+			c.logger().Warn("sink write failed, the range is scanned again",
+				"from_block", batch.FromBlock, "to_block", batch.ToBlock, "events", len(batch.Events), "err", err)
+			return err
+		}
+	}
+	if streaming {
+		return c.publish(rpcCtx, client, batch, backfill)
+	}
 	return nil
 }
 
+func (c *Contract) reportScan(head uint64, logs int) {
+	metrics.Default().Scan(metrics.ChainLabel(c.Chain, c.ChainId), c.watcher, head, c.GetProcessedBlockNumber(), logs)
+}
+
+func (c *Contract) blockNumber(ctx context.Context, client *rpcclient.EvmClient) (uint64, error) {
+	ctx, span := tracing.StartRPC(ctx, c.tracer, client.GetRawUrl(), "eth_blockNumber")
+	n, err := client.BlockNumber(ctx)
+	tracing.End(span, err)
+	return n, err
+}
+
+func (c *Contract) headerByNumber(ctx context.Context, client *rpcclient.EvmClient, number uint64) (*types.Header, error) {
+	ctx, span := tracing.StartRPC(ctx, c.tracer, client.GetRawUrl(), "eth_getBlockByNumber")
+	header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	tracing.End(span, err)
+	return header, err
+}
+
 func (c *Contract) getFilterQuery(startBlockNumber, endBlockNumber int64) ethereum.FilterQuery {
+	if c.AnyContract {
+		return c.filterQuery(nil, startBlockNumber, endBlockNumber)
+	}
+	return c.filterQuery(c.Addresses(), startBlockNumber, endBlockNumber)
+}
+
+func (c *Contract) hasTopics() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, topics := range c.Topics {
+		if len(topics) > 0 {
+			return true
+		}
+	}
+	return len(c.filters) > 0
+}
+
+// filterLogsTimeout each retry of the range has its own timeout
+func (c *Contract) filterLogsTimeout(ctx context.Context, client *rpcclient.EvmClient, query ethereum.FilterQuery) ([]types.Log, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return c.filterLogs(ctx, client, query)
+}
+
+// isRangeError the node rejects the range of eth_getLogs, too many blocks or results
+func isRangeError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"more than", "too many", "block range", "range is too", "response size", "exceeds max", "limited to"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Contract) getBlockLimit() int64 {
+	if !c.AnyContract {
+		return c.WatchBlockLimit
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.blockLimit
+}
+
+func (c *Contract) setBlockLimit(limit int64) {
+	c.mu.Lock()
+	c.blockLimit = limit
+	c.mu.Unlock()
+}
+
+func (c *Contract) filterQuery(addrs []common.Address, startBlockNumber, endBlockNumber int64) ethereum.FilterQuery {
 	query := ethereum.FilterQuery{
-		Addresses: c.Addrs,
+		Addresses: addrs,
 		FromBlock: big.NewInt(startBlockNumber),
 		ToBlock:   big.NewInt(endBlockNumber),
 	}
 
+	c.mu.RLock()
 	if len(c.Topics) > 0 {
-		c.mu.RLock()
-		query.Topics = c.Topics
-		c.mu.RUnlock()
+		query.Topics = make([][]common.Hash, len(c.Topics))
+		for i, topics := range c.Topics {
+			query.Topics[i] = slices.Clone(topics)
+		}
 		//query.Topics = make([][]common.Hash, 4)
 		//query.Topics[0] = append(c.Topics, topics[0]...)
 		//query.Topics[2] = []common.Hash{common.HexToHash("0x59330ab2485985a1cd76cb0239bd37378978b0ea"),
 		//	common.HexToHash("0x73bf6617837d6ada5e5a48c1017af46b016e2dcb")}
 	}
+	c.mu.RUnlock()
 
 	return query
 }
@@ -0,0 +1,210 @@
+package abs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/AcSunday/gwatch-chain/metrics"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/AcSunday/gwatch-chain/tracing"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	testToken    = common.HexToAddress("0x55d398326f99059ff775485246999027b3197955")
+	testTransfer = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+)
+
+func newTestContract(addrs []common.Address, attrs Attrs) *Contract {
+	c := &Contract{Addrs: addrs}
+	c.Init(attrs)
+	return c
+}
+
+func transferLog(block uint64, index uint) types.Log {
+	return types.Log{
+		Address:     testToken,
+		Topics:      []common.Hash{testTransfer, {1}, {2}},
+		Data:        common.LeftPadBytes([]byte{1}, 32),
+		BlockNumber: block,
+		BlockHash:   common.Hash{byte(block)},
+		TxHash:      common.Hash{byte(block), byte(index)},
+		Index:       index,
+	}
+}
+
+type testSink struct {
+	batches []*Batch
+	fail    error
+}
+
+func (s *testSink) Write(ctx context.Context, batch *Batch) error {
+	if s.fail != nil {
+		err := s.fail
+		s.fail = nil
+		return err
+	}
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func (s *testSink) Close() error { return nil }
+
+func TestScanSink(t *testing.T) {
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(120)
+	node.AddLogs(transferLog(101, 0), transferLog(105, 3))
+	client := node.Client(t)
+
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100, WatchBlockLimit: 10})
+	defer c.Close()
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+
+	hooked := 0
+	c.RegisterEventHook(Event(testTransfer.Hex()), func(client *rpcclient.EvmClient, log types.Log) error {
+		hooked++
+		return nil
+	})
+	s := &testSink{fail: errors.New("sink unavailable")}
+	if err := c.RegisterSink(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// the checkpoint is not committed if the sink failed
+	if err := c.Scan(client); err == nil {
+		t.Fatal("expected sink error")
+	}
+	if c.GetProcessedBlockNumber() != 100 {
+		t.Fatalf("processed block number moved to %d", c.GetProcessedBlockNumber())
+	}
+
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetProcessedBlockNumber() != 111 {
+		t.Fatalf("unexpected processed block number %d", c.GetProcessedBlockNumber())
+	}
+	if hooked != 4 {
+		t.Fatalf("expected the logs are handled at least once, hooked %d", hooked)
+	}
+	if len(s.batches) != 1 || len(s.batches[0].Events) != 2 {
+		t.Fatalf("unexpected batches: %+v", s.batches)
+	}
+	b := s.batches[0]
+	if b.FromBlock != 101 || b.ToBlock != 111 || b.Events[1].LogIndex != 3 || b.Events[1].ChainId != 56 {
+		t.Fatalf("unexpected batch: %+v", b)
+	}
+}
+
+func TestScanLogger(t *testing.T) {
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(120)
+	node.AddLogs(transferLog(101, 0))
+	client := node.Client(t)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100, Logger: logger})
+	defer c.Close()
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+	c.RegisterEventHook(Event(testTransfer.Hex()), func(client *rpcclient.EvmClient, log types.Log) error {
+		return errors.New("db down")
+	})
+
+	if err := c.Scan(client); err == nil {
+		t.Fatal("expected hook error")
+	}
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["level"] != "WARN" || record["chain_id"] != float64(56) || record["block_number"] != float64(101) || record["err"] != "db down" {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+}
+
+func TestScanTracing(t *testing.T) {
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(120)
+	node.AddLogs(transferLog(101, 0))
+	client := node.Client(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100, TracerProvider: tp})
+	defer c.Close()
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+	c.RegisterEventHookContext(Event(testTransfer.Hex()), func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		_, span := tp.Tracer("app").Start(ctx, "app.hook")
+		span.End()
+		return nil
+	})
+
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+	}
+	scan, ok := spans[tracing.ScanSpan]
+	if !ok {
+		t.Fatalf("scan span not found: %v", spans)
+	}
+	for _, name := range []string{"eth_blockNumber", "eth_getLogs", tracing.HookSpan} {
+		s, ok := spans[name]
+		if !ok || s.Parent.SpanID() != scan.SpanContext.SpanID() {
+			t.Fatalf("span %s is not a child of the scan span", name)
+		}
+	}
+	if spans["app.hook"].Parent.SpanID() != spans[tracing.HookSpan].SpanContext.SpanID() {
+		t.Fatal("span of the hook is not a child of the hook span")
+	}
+	attrs := attribute.NewSet(scan.Attributes...)
+	if v, _ := attrs.Value(tracing.ToBlockKey); v.AsInt64() != 120 {
+		t.Fatalf("unexpected to block: %v", v.Emit())
+	}
+}
+
+func TestScanHookContext(t *testing.T) {
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(120)
+	node.AddLogs(transferLog(101, 0))
+	client := node.Client(t)
+
+	c := newTestContract([]common.Address{testToken}, Attrs{ChainId: 56, ProcessedBlockNumber: 100})
+	c.RegisterWatchEvent(Event(testTransfer.Hex()))
+	var hookCtx context.Context
+	c.RegisterEventHookContext(Event(testTransfer.Hex()), func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		hookCtx = ctx
+		return nil
+	})
+
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	info, ok := ScanInfoFromContext(hookCtx)
+	if !ok || info.FromBlock != 101 || info.ToBlock != 120 || info.LatestBlock != 120 || info.Node != metrics.NodeLabel(node.URL()) {
+		t.Fatalf("unexpected scan info: %+v", info)
+	}
+	if hookCtx.Err() != nil {
+		t.Fatal("hook context is cancelled before Close")
+	}
+	c.Close()
+	if hookCtx.Err() == nil {
+		t.Fatal("hook context is not cancelled after Close")
+	}
+}
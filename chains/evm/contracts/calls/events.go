@@ -0,0 +1,81 @@
+package calls
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// MethodEvent synthetic event of the calls of the method selector, topics[0] is the left padded selector
+func MethodEvent(selector []byte) abs.Event {
+	return abs.Event(common.BytesToHash(selector).Hex())
+}
+
+// Call decoded transaction calling a watched contract
+type Call struct {
+	Method   string         // name of the method in the ABI, empty if the selector is unknown
+	Selector [4]byte        // method id
+	Args     map[string]any // decoded arguments, nil if the method is unknown
+	From     common.Address
+	To       common.Address
+	Value    *big.Int
+	Status   uint64 // status of the receipt, types.ReceiptStatusSuccessful or types.ReceiptStatusFailed
+	GasUsed  uint64
+	Input    []byte
+}
+
+// callLog the synthetic log of a call
+//
+//	topics: [selector, from]
+//	data: value (32 bytes), status (32 bytes), gas used (32 bytes), input
+func callLog(c Call, number uint64, blockHash, txHash common.Hash, txIndex uint) types.Log {
+	data := make([]byte, 0, 96+len(c.Input))
+	data = append(data, common.BigToHash(c.Value).Bytes()...)
+	data = append(data, common.BigToHash(new(big.Int).SetUint64(c.Status)).Bytes()...)
+	data = append(data, common.BigToHash(new(big.Int).SetUint64(c.GasUsed)).Bytes()...)
+	data = append(data, c.Input...)
+	return types.Log{
+		Address:     c.To,
+		Topics:      []common.Hash{common.HexToHash(MethodEvent(c.Selector[:]).String()), common.BytesToHash(c.From.Bytes())},
+		Data:        data,
+		BlockNumber: number,
+		BlockHash:   blockHash,
+		TxHash:      txHash,
+		TxIndex:     txIndex,
+		Index:       abs.CallLogIndexBase + txIndex,
+	}
+}
+
+// DecodeCall decode the synthetic log of a call, the arguments are decoded by contractABI,
+// the call without Args is returned with the error if the input does not match the method
+func DecodeCall(contractABI abi.ABI, log types.Log) (Call, error) {
+	if len(log.Topics) != 2 || len(log.Data) < 96+4 || common.BytesToHash(log.Data[96:100]) != log.Topics[0] {
+		return Call{}, errors.New("not a call log")
+	}
+	c := Call{
+		From:    common.BytesToAddress(log.Topics[1].Bytes()),
+		To:      log.Address,
+		Value:   new(big.Int).SetBytes(log.Data[:32]),
+		Status:  new(big.Int).SetBytes(log.Data[32:64]).Uint64(),
+		GasUsed: new(big.Int).SetBytes(log.Data[64:96]).Uint64(),
+		Input:   log.Data[96:],
+	}
+	copy(c.Selector[:], c.Input[:4])
+
+	method, err := contractABI.MethodById(c.Selector[:])
+	if err != nil {
+		return c, nil
+	}
+	c.Method = method.Name
+	args := make(map[string]any)
+	if err = method.Inputs.UnpackIntoMap(args, c.Input[4:]); err != nil {
+		return c, fmt.Errorf("decode input of %s failed, %v", method.Name, err)
+	}
+	c.Args = args
+	return c, nil
+}
@@ -0,0 +1,172 @@
+// Package calls watches the transactions calling the contracts as synthetic logs decoded by the contract ABI, see New
+package calls
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// HookFunc handles a decoded call
+type HookFunc func(ctx context.Context, client *rpcclient.EvmClient, call Call) error
+
+type Calls struct {
+	abs.Contract
+	abi abi.ABI
+}
+
+// New watches the transactions calling addrs, every transaction is a synthetic log of MethodEvent of its selector,
+// the address of the log is the called contract, the log index is abs.CallLogIndexBase plus the transaction index,
+// the logs are dispatched to the hooks, the sinks and Events like the contract logs and decoded into Call by contractABI,
+// the failed transactions are included, the transactions without a selector, e.g. plain transfers, are not
+func New(addrs []common.Address, attrs *abs.Attrs, contractABI abi.ABI) *Calls {
+	c := &Calls{
+		Contract: abs.Contract{
+			Addrs: addrs,
+		},
+		abi: contractABI,
+	}
+	c.Init(*attrs)
+	c.RegisterDecoder(c.decode)
+	c.RegisterLogSource(c.callLogs)
+	return c
+}
+
+// Event the synthetic event of the method in the ABI
+func (c *Calls) Event(method string) (abs.Event, error) {
+	m, ok := c.abi.Methods[method]
+	if !ok {
+		return "", fmt.Errorf("method %s not found in the abi", method)
+	}
+	return MethodEvent(m.ID), nil
+}
+
+// WatchMethods only the calls of the methods are dispatched, all calls are dispatched by default
+func (c *Calls) WatchMethods(methods ...string) error {
+	events := make([]abs.Event, 0, len(methods))
+	for _, method := range methods {
+		event, err := c.Event(method)
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+	}
+	return c.RegisterWatchEvent(events...)
+}
+
+// RegisterMethodHook Hook of the calls of the method, the hooks of a method are called in order of registration
+func (c *Calls) RegisterMethodHook(method string, f HookFunc) (abs.Unregister, error) {
+	event, err := c.Event(method)
+	if err != nil {
+		return nil, err
+	}
+	return c.AddEventHook(event, func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		call, err := c.Decode(log)
+		if err != nil && call.Input == nil {
+			return err
+		}
+		return f(ctx, client, call)
+	})
+}
+
+// Decode the synthetic log of a call, see DecodeCall
+func (c *Calls) Decode(log types.Log) (Call, error) {
+	return DecodeCall(c.abi, log)
+}
+
+func (c *Calls) decode(log types.Log) any {
+	call, err := c.Decode(log)
+	if call.Input == nil && err != nil {
+		return nil
+	}
+	return call
+}
+
+type rpcTx struct {
+	Hash  common.Hash     `json:"hash"`
+	From  common.Address  `json:"from"`
+	To    *common.Address `json:"to"`
+	Value *hexutil.Big    `json:"value"`
+	Input hexutil.Bytes   `json:"input"`
+}
+
+type rpcBlock struct {
+	Hash         common.Hash `json:"hash"`
+	Transactions []rpcTx     `json:"transactions"`
+}
+
+// callLogs the synthetic logs of the transactions calling query.Addresses in the blocks of the query
+func (c *Calls) callLogs(ctx context.Context, client *rpcclient.EvmClient, query ethereum.FilterQuery) ([]types.Log, error) {
+	from, to := query.FromBlock.Uint64(), query.ToBlock.Uint64()
+	watched := make(map[common.Address]struct{}, len(query.Addresses))
+	for _, addr := range query.Addresses {
+		watched[addr] = struct{}{}
+	}
+
+	args := make([][]any, 0, to-from+1)
+	for n := from; n <= to; n++ {
+		args = append(args, []any{hexutil.EncodeUint64(n), true})
+	}
+	blocks, errs, err := rpcclient.BatchGet[rpcBlock](ctx, client, "eth_getBlockByNumber", args)
+	if err != nil {
+		return nil, err
+	}
+
+	type pending struct {
+		call      Call
+		number    uint64
+		blockHash common.Hash
+		txHash    common.Hash
+		txIndex   uint
+	}
+	var (
+		calls  []pending
+		hashes []common.Hash
+	)
+	for i, b := range blocks {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("get block %d failed, %v", from+uint64(i), errs[i])
+		}
+		for txIndex, tx := range b.Transactions {
+			if tx.To == nil || len(tx.Input) < 4 {
+				continue
+			}
+			if _, ok := watched[*tx.To]; !ok && len(watched) > 0 {
+				continue
+			}
+			call := Call{From: tx.From, To: *tx.To, Value: new(big.Int), Input: tx.Input}
+			copy(call.Selector[:], tx.Input[:4])
+			if tx.Value != nil {
+				call.Value = tx.Value.ToInt()
+			}
+			calls = append(calls, pending{call: call, number: from + uint64(i), blockHash: b.Hash, txHash: tx.Hash, txIndex: uint(txIndex)})
+			hashes = append(hashes, tx.Hash)
+		}
+	}
+	if len(calls) == 0 {
+		return nil, nil
+	}
+
+	// status and gas used of the receipts
+	receipts, errs, err := client.TransactionReceipts(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	logs := make([]types.Log, 0, len(calls))
+	for i, p := range calls {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("get receipt of %s failed, %v", hashes[i], errs[i])
+		}
+		p.call.Status, p.call.GasUsed = receipts[i].Status, receipts[i].GasUsed
+		logs = append(logs, callLog(p.call, p.number, p.blockHash, p.txHash, p.txIndex))
+	}
+	return logs, nil
+}
@@ -0,0 +1,98 @@
+package calls
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const testABI = `[
+	{"name": "registerPID", "type": "function", "inputs": [{"name": "name_", "type": "string"},{"name": "code_", "type": "string"}], "outputs": []},
+	{"name": "transfer", "type": "function", "inputs": [{"name": "to", "type": "address"},{"name": "value", "type": "uint256"}], "outputs": [{"name": "", "type": "bool"}]}
+]`
+
+func TestWatch(t *testing.T) {
+	contractABI, err := abi.JSON(strings.NewReader(testABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract, other, sender := common.HexToAddress("0xc0"), common.HexToAddress("0xf0"), common.HexToAddress("0x5e")
+	register := hexutil.MustDecode("0x806578880000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000008000000000000000000000000000000000000000000000000000000000000000083431333431323334000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000a3534353332343532343500000000000000000000000000000000000000000000")
+	transfer, err := contractABI.Pack("transfer", other, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(110)
+	node.AddTxs(101,
+		evmtest.Tx{Transaction: types.NewTransaction(0, contract, big.NewInt(1), 90000, big.NewInt(1), register), From: sender, GasUsed: 50000},
+		evmtest.Tx{Transaction: types.NewTransaction(1, other, new(big.Int), 90000, big.NewInt(1), transfer), From: sender},
+	)
+	node.AddTxs(102, evmtest.Tx{Transaction: types.NewTransaction(2, contract, new(big.Int), 90000, big.NewInt(1), transfer), From: sender, Failed: true, GasUsed: 30000})
+	node.AddTxs(103,
+		evmtest.Tx{Transaction: types.NewTransaction(3, contract, big.NewInt(1), 21000, big.NewInt(1), nil), From: sender},
+		evmtest.Tx{Transaction: types.NewTransaction(4, contract, new(big.Int), 90000, big.NewInt(1), []byte{0xde, 0xad, 0xbe, 0xef}), From: sender},
+	)
+	client := node.Client(t)
+
+	c := New([]common.Address{contract}, &abs.Attrs{ChainId: 56, ProcessedBlockNumber: 100}, contractABI)
+	defer c.Close()
+	var seen []string
+	c.RegisterMethodHook("registerPID", func(ctx context.Context, client *rpcclient.EvmClient, call Call) error {
+		seen = append(seen, fmt.Sprintf("%s(%v,%v) value=%v status=%d gas=%d", call.Method, call.Args["name_"], call.Args["code_"], call.Value, call.Status, call.GasUsed))
+		return nil
+	})
+	c.RegisterMethodHook("transfer", func(ctx context.Context, client *rpcclient.EvmClient, call Call) error {
+		seen = append(seen, fmt.Sprintf("%s(%x,%v) status=%d gas=%d", call.Method, call.Args["to"].(common.Address).Bytes()[19:], call.Args["value"], call.Status, call.GasUsed))
+		return nil
+	})
+	c.AddUnhandledEventHook(func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		e, _ := abs.EnvelopeFromContext(ctx)
+		call := e.Decoded.(Call)
+		seen = append(seen, fmt.Sprintf("unknown %x from %x", call.Selector, call.From.Bytes()[19:]))
+		return nil
+	})
+	if _, err = c.RegisterMethodHook("approve", nil); err == nil {
+		t.Fatal("expected unknown method error")
+	}
+
+	if err = c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	want := "[registerPID(41341234,5453245245) value=1 status=1 gas=50000 transfer(f0,100) status=0 gas=30000 unknown deadbeef from 5e]"
+	if fmt.Sprint(seen) != want {
+		t.Fatalf("unexpected calls: %v", seen)
+	}
+
+	// only the watched methods
+	watched := New([]common.Address{contract}, &abs.Attrs{ChainId: 56, ProcessedBlockNumber: 100}, contractABI)
+	defer watched.Close()
+	if err = watched.WatchMethods("transfer"); err != nil {
+		t.Fatal(err)
+	}
+	var blocks []uint64
+	watched.AddEventHook(abs.AnyEvent, func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+		blocks = append(blocks, log.BlockNumber)
+		if log.Index != abs.CallLogIndexBase+log.TxIndex {
+			t.Fatalf("unexpected log index %d of transaction %d", log.Index, log.TxIndex)
+		}
+		return nil
+	})
+	if err = watched.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(blocks) != "[102]" {
+		t.Fatalf("unexpected calls: %v", blocks)
+	}
+}
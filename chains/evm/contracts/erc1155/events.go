@@ -1 +1,136 @@
 package erc1155
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc721"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// string event
+const (
+	transferSingleEvent = "TransferSingle"
+	transferBatchEvent  = "TransferBatch"
+	approvalForAll      = "ApprovalForAll"
+	uriEvent            = "URI"
+)
+
+// TransferSingleEvent
+//
+//	TransferSingle(address indexed operator, address indexed from, address indexed to, uint256 id, uint256 value);
+func TransferSingleEvent() abs.Event {
+	return abs.Event(crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)")).Hex())
+}
+
+// TransferBatchEvent
+//
+//	TransferBatch(address indexed operator, address indexed from, address indexed to, uint256[] ids, uint256[] values);
+func TransferBatchEvent() abs.Event {
+	return abs.Event(crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])")).Hex())
+}
+
+// ApprovalForAllEvent
+//
+//	ApprovalForAll(address indexed account, address indexed operator, bool approved);
+func ApprovalForAllEvent() abs.Event {
+	return abs.Event(crypto.Keccak256Hash([]byte("ApprovalForAll(address,address,bool)")).Hex())
+}
+
+// URIEvent
+//
+//	URI(string value, uint256 indexed id);
+func URIEvent() abs.Event {
+	return abs.Event(crypto.Keccak256Hash([]byte("URI(string,uint256)")).Hex())
+}
+
+// EventToName ...
+func EventToName(event abs.Event) string {
+	switch event {
+	case TransferSingleEvent():
+		return transferSingleEvent
+	case TransferBatchEvent():
+		return transferBatchEvent
+	case ApprovalForAllEvent():
+		return approvalForAll
+	case URIEvent():
+		return uriEvent
+	}
+
+	return ""
+}
+
+// Transfer decoded TransferSingle log, or one of the ids of TransferBatch log
+type Transfer struct {
+	Operator common.Address
+	From     common.Address
+	To       common.Address
+	Id       *big.Int
+	Value    *big.Int
+}
+
+var uint256ArrayType, _ = abi.NewType("uint256[]", "", nil)
+
+// DecodeTransferSingle decode the TransferSingle log
+func DecodeTransferSingle(log types.Log) (Transfer, error) {
+	if len(log.Topics) != 4 || abs.Event(log.Topics[0].Hex()) != TransferSingleEvent() || len(log.Data) != 64 {
+		return Transfer{}, errors.New("not an erc1155 TransferSingle log")
+	}
+	return Transfer{
+		Operator: common.BytesToAddress(log.Topics[1].Bytes()),
+		From:     common.BytesToAddress(log.Topics[2].Bytes()),
+		To:       common.BytesToAddress(log.Topics[3].Bytes()),
+		Id:       new(big.Int).SetBytes(log.Data[:32]),
+		Value:    new(big.Int).SetBytes(log.Data[32:]),
+	}, nil
+}
+
+// DecodeTransferBatch decode the TransferBatch log, one Transfer per id in order
+func DecodeTransferBatch(log types.Log) ([]Transfer, error) {
+	if len(log.Topics) != 4 || abs.Event(log.Topics[0].Hex()) != TransferBatchEvent() {
+		return nil, errors.New("not an erc1155 TransferBatch log")
+	}
+	values, err := abi.Arguments{{Type: uint256ArrayType}, {Type: uint256ArrayType}}.Unpack(log.Data)
+	if err != nil {
+		return nil, fmt.Errorf("unpack TransferBatch data, %v", err)
+	}
+	ids, amounts := values[0].([]*big.Int), values[1].([]*big.Int)
+	if len(ids) != len(amounts) {
+		return nil, fmt.Errorf("TransferBatch ids length %d mismatch values length %d", len(ids), len(amounts))
+	}
+
+	res := make([]Transfer, len(ids))
+	for i := range ids {
+		res[i] = Transfer{
+			Operator: common.BytesToAddress(log.Topics[1].Bytes()),
+			From:     common.BytesToAddress(log.Topics[2].Bytes()),
+			To:       common.BytesToAddress(log.Topics[3].Bytes()),
+			Id:       ids[i],
+			Value:    amounts[i],
+		}
+	}
+	return res, nil
+}
+
+// Decode the TransferSingle or TransferBatch log, returns nil if the log is not decoded
+//
+//	TransferSingle: Transfer
+//	TransferBatch: []Transfer
+//	ApprovalForAll: erc721.ApprovalForAll
+func Decode(log types.Log) any {
+	if v, err := DecodeTransferSingle(log); err == nil {
+		return v
+	}
+	if v, err := DecodeTransferBatch(log); err == nil {
+		return v
+	}
+	if v, err := erc721.DecodeApprovalForAll(log); err == nil {
+		return v
+	}
+	return nil
+}
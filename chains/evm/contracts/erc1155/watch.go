@@ -1 +1,21 @@
 package erc1155
+
+import (
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type ERC1155 struct {
+	abs.Contract
+}
+
+func New(addrs []common.Address, attrs *abs.Attrs) *ERC1155 {
+	e := &ERC1155{
+		Contract: abs.Contract{
+			Addrs: addrs,
+		},
+	}
+	e.Init(*attrs)
+	e.RegisterDecoder(Decode)
+	return e
+}
@@ -1,7 +1,12 @@
 package erc20
 
 import (
+	"errors"
+	"math/big"
+
 	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
@@ -36,3 +41,52 @@ func EventToName(event abs.Event) string {
 
 	return ""
 }
+
+// Transfer decoded Transfer log
+type Transfer struct {
+	From  common.Address
+	To    common.Address
+	Value *big.Int
+}
+
+// Approval decoded Approval log
+type Approval struct {
+	Owner   common.Address
+	Spender common.Address
+	Value   *big.Int
+}
+
+// DecodeTransfer decode the Transfer log, the ERC721 Transfer has an indexed tokenId and is rejected
+func DecodeTransfer(log types.Log) (Transfer, error) {
+	if len(log.Topics) != 3 || abs.Event(log.Topics[0].Hex()) != TransferEvent() || len(log.Data) != 32 {
+		return Transfer{}, errors.New("not an erc20 Transfer log")
+	}
+	return Transfer{
+		From:  common.BytesToAddress(log.Topics[1].Bytes()),
+		To:    common.BytesToAddress(log.Topics[2].Bytes()),
+		Value: new(big.Int).SetBytes(log.Data),
+	}, nil
+}
+
+// DecodeApproval decode the Approval log
+func DecodeApproval(log types.Log) (Approval, error) {
+	if len(log.Topics) != 3 || abs.Event(log.Topics[0].Hex()) != ApprovalEvent() || len(log.Data) != 32 {
+		return Approval{}, errors.New("not an erc20 Approval log")
+	}
+	return Approval{
+		Owner:   common.BytesToAddress(log.Topics[1].Bytes()),
+		Spender: common.BytesToAddress(log.Topics[2].Bytes()),
+		Value:   new(big.Int).SetBytes(log.Data),
+	}, nil
+}
+
+// Decode the Transfer or Approval log, returns nil if the log is not decoded
+func Decode(log types.Log) any {
+	if v, err := DecodeTransfer(log); err == nil {
+		return v
+	}
+	if v, err := DecodeApproval(log); err == nil {
+		return v
+	}
+	return nil
+}
@@ -16,5 +16,6 @@ func New(addrs []common.Address, attrs *abs.Attrs) *ERC20 {
 		},
 	}
 	e.Init(*attrs)
+	e.RegisterDecoder(Decode)
 	return e
 }
@@ -1,7 +1,12 @@
 package erc721
 
 import (
+	"errors"
+	"math/big"
+
 	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
@@ -46,3 +51,74 @@ func EventToName(event abs.Event) string {
 
 	return ""
 }
+
+// Transfer decoded Transfer log
+type Transfer struct {
+	From    common.Address
+	To      common.Address
+	TokenId *big.Int
+}
+
+// Approval decoded Approval log
+type Approval struct {
+	Owner    common.Address
+	Approved common.Address
+	TokenId  *big.Int
+}
+
+// ApprovalForAll decoded ApprovalForAll log, the same event of ERC1155
+type ApprovalForAll struct {
+	Owner    common.Address
+	Operator common.Address
+	Approved bool
+}
+
+// DecodeTransfer decode the Transfer log, the ERC20 Transfer has no indexed tokenId and is rejected
+func DecodeTransfer(log types.Log) (Transfer, error) {
+	if len(log.Topics) != 4 || abs.Event(log.Topics[0].Hex()) != TransferEvent() {
+		return Transfer{}, errors.New("not an erc721 Transfer log")
+	}
+	return Transfer{
+		From:    common.BytesToAddress(log.Topics[1].Bytes()),
+		To:      common.BytesToAddress(log.Topics[2].Bytes()),
+		TokenId: log.Topics[3].Big(),
+	}, nil
+}
+
+// DecodeApproval decode the Approval log
+func DecodeApproval(log types.Log) (Approval, error) {
+	if len(log.Topics) != 4 || abs.Event(log.Topics[0].Hex()) != ApprovalEvent() {
+		return Approval{}, errors.New("not an erc721 Approval log")
+	}
+	return Approval{
+		Owner:    common.BytesToAddress(log.Topics[1].Bytes()),
+		Approved: common.BytesToAddress(log.Topics[2].Bytes()),
+		TokenId:  log.Topics[3].Big(),
+	}, nil
+}
+
+// DecodeApprovalForAll decode the ApprovalForAll log
+func DecodeApprovalForAll(log types.Log) (ApprovalForAll, error) {
+	if len(log.Topics) != 3 || abs.Event(log.Topics[0].Hex()) != ApprovalForAllEvent() || len(log.Data) != 32 {
+		return ApprovalForAll{}, errors.New("not an ApprovalForAll log")
+	}
+	return ApprovalForAll{
+		Owner:    common.BytesToAddress(log.Topics[1].Bytes()),
+		Operator: common.BytesToAddress(log.Topics[2].Bytes()),
+		Approved: new(big.Int).SetBytes(log.Data).Sign() != 0,
+	}, nil
+}
+
+// Decode the Transfer, Approval or ApprovalForAll log, returns nil if the log is not decoded
+func Decode(log types.Log) any {
+	if v, err := DecodeTransfer(log); err == nil {
+		return v
+	}
+	if v, err := DecodeApproval(log); err == nil {
+		return v
+	}
+	if v, err := DecodeApprovalForAll(log); err == nil {
+		return v
+	}
+	return nil
+}
@@ -16,5 +16,6 @@ func New(addrs []common.Address, attrs *abs.Attrs) *ERC721 {
 		},
 	}
 	e.Init(*attrs)
+	e.RegisterDecoder(Decode)
 	return e
 }
@@ -1,6 +1,7 @@
 package contracts
 
 import (
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc1155"
 	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc20"
 	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc721"
 	"testing"
@@ -13,4 +14,8 @@ func TestGetEvents(t *testing.T) {
 	t.Logf("--- ERC721 TransferEvent: %s", erc721.TransferEvent())
 	t.Logf("--- ERC721 ApprovalEvent: %s", erc721.ApprovalEvent())
 	t.Logf("--- ERC721 ApprovalForAllEvent: %s", erc721.ApprovalForAllEvent())
+
+	t.Logf("--- ERC1155 TransferSingleEvent: %s", erc1155.TransferSingleEvent())
+	t.Logf("--- ERC1155 TransferBatchEvent: %s", erc1155.TransferBatchEvent())
+	t.Logf("--- ERC1155 URIEvent: %s", erc1155.URIEvent())
 }
@@ -0,0 +1,76 @@
+package native
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// string event
+const (
+	transferEvent         = "NativeTransfer"
+	internalTransferEvent = "NativeInternalTransfer"
+)
+
+// TransferEvent synthetic event of the value of a transaction
+//
+// NativeTransfer(address indexed from, address indexed to, uint256 value);
+func TransferEvent() abs.Event {
+	return abs.Event(crypto.Keccak256Hash([]byte("NativeTransfer(address,address,uint256)")).Hex())
+}
+
+// InternalTransferEvent synthetic event of the value of an internal call, create or selfdestruct
+//
+// NativeInternalTransfer(address indexed from, address indexed to, uint256 value);
+func InternalTransferEvent() abs.Event {
+	return abs.Event(crypto.Keccak256Hash([]byte("NativeInternalTransfer(address,address,uint256)")).Hex())
+}
+
+// EventToName ...
+func EventToName(event abs.Event) string {
+	switch event {
+	case TransferEvent():
+		return transferEvent
+	case InternalTransferEvent():
+		return internalTransferEvent
+	}
+
+	return ""
+}
+
+// Transfer decoded native transfer
+type Transfer struct {
+	From     common.Address
+	To       common.Address
+	Value    *big.Int
+	Internal bool
+}
+
+// DecodeTransfer decode the synthetic log of a native transfer
+func DecodeTransfer(log types.Log) (Transfer, error) {
+	if len(log.Topics) != 3 || len(log.Data) != 32 {
+		return Transfer{}, errors.New("not a native transfer log")
+	}
+	event := abs.Event(log.Topics[0].Hex())
+	if event != TransferEvent() && event != InternalTransferEvent() {
+		return Transfer{}, errors.New("not a native transfer log")
+	}
+	return Transfer{
+		From:     common.BytesToAddress(log.Topics[1].Bytes()),
+		To:       common.BytesToAddress(log.Topics[2].Bytes()),
+		Value:    new(big.Int).SetBytes(log.Data),
+		Internal: event == InternalTransferEvent(),
+	}, nil
+}
+
+// Decode the native transfer log, returns nil if the log is not decoded
+func Decode(log types.Log) any {
+	if v, err := DecodeTransfer(log); err == nil {
+		return v
+	}
+	return nil
+}
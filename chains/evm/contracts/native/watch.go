@@ -0,0 +1,349 @@
+// Package native watches the native currency transfers, e.g. ETH, BNB and MATIC, as synthetic logs, see New
+package native
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Trace how the internal transfers are found
+type Trace int
+
+const (
+	TraceNone       Trace = iota // the value of the transactions only
+	TraceCallTracer              // debug_traceBlockByNumber with callTracer, e.g. geth and erigon
+	TraceParity                  // trace_block, e.g. erigon, nethermind and reth
+)
+
+type Native struct {
+	abs.Contract
+	trace Trace
+}
+
+// New watches the native transfers from or to addrs, every transfer is a synthetic log of TransferEvent or
+// InternalTransferEvent, the address of the log is the watched receiver, or the watched sender,
+// the log index is abs.NativeLogIndexBase plus the index of the transfer in the block,
+// the logs are dispatched to the hooks, the sinks and Events like the contract logs,
+// a transaction creating a contract is not a transfer, the value of the failed transactions and calls is ignored
+func New(addrs []common.Address, attrs *abs.Attrs, trace Trace) *Native {
+	n := &Native{
+		Contract: abs.Contract{
+			Addrs: addrs,
+		},
+		trace: trace,
+	}
+	n.Init(*attrs)
+	n.RegisterDecoder(Decode)
+	n.RegisterLogSource(n.transferLogs)
+	return n
+}
+
+type rpcTx struct {
+	Hash  common.Hash     `json:"hash"`
+	From  common.Address  `json:"from"`
+	To    *common.Address `json:"to"`
+	Value *hexutil.Big    `json:"value"`
+}
+
+type rpcBlock struct {
+	Hash         common.Hash `json:"hash"`
+	Transactions []rpcTx     `json:"transactions"`
+}
+
+// txTrace the result of tracing a transaction
+type txTrace struct {
+	failed    bool
+	transfers []transfer // internal transfers of the successful frames in order
+}
+
+type transfer struct {
+	from, to common.Address
+	value    *big.Int
+}
+
+// transferLogs the synthetic logs of the transfers in the blocks of the query from or to query.Addresses,
+// the log index is the position of the transfer in the block
+func (n *Native) transferLogs(ctx context.Context, client *rpcclient.EvmClient, query ethereum.FilterQuery) ([]types.Log, error) {
+	from, to := query.FromBlock.Uint64(), query.ToBlock.Uint64()
+	watched := make(map[common.Address]struct{}, len(query.Addresses))
+	for _, addr := range query.Addresses {
+		watched[addr] = struct{}{}
+	}
+	// address of the log, false if the transfer is not watched
+	owner := func(t transfer) (common.Address, bool) {
+		if _, ok := watched[t.to]; ok || len(watched) == 0 {
+			return t.to, true
+		}
+		_, ok := watched[t.from]
+		return t.from, ok
+	}
+
+	blocks, err := getBlocks(ctx, client, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var traces [][]*txTrace
+	switch n.trace {
+	case TraceCallTracer:
+		traces, err = callTraces(ctx, client, from, to)
+	case TraceParity:
+		traces, err = parityTraces(ctx, client, from, to)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		logs    []types.Log
+		unknown []int // logs of which the transaction status is unknown without traces
+	)
+	for i, b := range blocks {
+		number := from + uint64(i)
+		index := uint(0)
+		for txIndex, tx := range b.Transactions {
+			var trace *txTrace
+			if traces != nil {
+				if txIndex >= len(traces[i]) {
+					return nil, fmt.Errorf("trace of transaction %s in block %d not found", tx.Hash, number)
+				}
+				trace = traces[i][txIndex]
+			}
+			emit := func(event abs.Event, t transfer) {
+				if addr, ok := owner(t); ok {
+					logs = append(logs, transferLog(event, addr, t, number, b.Hash, tx.Hash, uint(txIndex), index))
+					if trace == nil {
+						unknown = append(unknown, len(logs)-1)
+					}
+				}
+				index++
+			}
+
+			if trace != nil && trace.failed {
+				continue
+			}
+			if tx.To != nil && tx.Value != nil && tx.Value.ToInt().Sign() > 0 {
+				emit(TransferEvent(), transfer{from: tx.From, to: *tx.To, value: tx.Value.ToInt()})
+			}
+			if trace != nil {
+				for _, t := range trace.transfers {
+					emit(InternalTransferEvent(), t)
+				}
+			}
+		}
+	}
+	if len(unknown) == 0 {
+		return logs, nil
+	}
+
+	// the value of a failed transaction is not transferred
+	hashes := make([]common.Hash, len(unknown))
+	for i, k := range unknown {
+		hashes[i] = logs[k].TxHash
+	}
+	receipts, errs, err := client.TransactionReceipts(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	failed := make(map[common.Hash]bool, len(receipts))
+	for i, r := range receipts {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("get receipt of %s failed, %v", hashes[i], errs[i])
+		}
+		failed[hashes[i]] = r.Status == types.ReceiptStatusFailed
+	}
+	res := logs[:0]
+	for _, l := range logs {
+		if !failed[l.TxHash] {
+			res = append(res, l)
+		}
+	}
+	return res, nil
+}
+
+func transferLog(event abs.Event, addr common.Address, t transfer, number uint64, blockHash, txHash common.Hash, txIndex, index uint) types.Log {
+	return types.Log{
+		Address:     addr,
+		Topics:      []common.Hash{common.HexToHash(event.String()), common.BytesToHash(t.from.Bytes()), common.BytesToHash(t.to.Bytes())},
+		Data:        common.BigToHash(t.value).Bytes(),
+		BlockNumber: number,
+		BlockHash:   blockHash,
+		TxHash:      txHash,
+		TxIndex:     txIndex,
+		Index:       abs.NativeLogIndexBase + index,
+	}
+}
+
+// batch calls method for the blocks [from, to], results[i] is the result of block from+i
+func batch[T any](ctx context.Context, client *rpcclient.EvmClient, method string, from, to uint64, args ...any) ([]T, error) {
+	blockArgs := make([][]any, 0, to-from+1)
+	for n := from; n <= to; n++ {
+		blockArgs = append(blockArgs, append([]any{hexutil.EncodeUint64(n)}, args...))
+	}
+	results, errs, err := rpcclient.BatchGet[T](ctx, client, method, blockArgs)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]T, len(results))
+	for i, r := range results {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("%s of block %d failed, %v", method, from+uint64(i), errs[i])
+		}
+		res[i] = *r
+	}
+	return res, nil
+}
+
+func getBlocks(ctx context.Context, client *rpcclient.EvmClient, from, to uint64) ([]rpcBlock, error) {
+	return batch[rpcBlock](ctx, client, "eth_getBlockByNumber", from, to, true)
+}
+
+// callFrame the result of callTracer
+type callFrame struct {
+	Type  string          `json:"type"`
+	From  common.Address  `json:"from"`
+	To    *common.Address `json:"to"`
+	Value *hexutil.Big    `json:"value"`
+	Error string          `json:"error"`
+	Calls []callFrame     `json:"calls"`
+}
+
+// internalTransfers the value of the successful sub calls
+func (f callFrame) internalTransfers(res []transfer) []transfer {
+	for _, sub := range f.Calls {
+		if sub.Error != "" {
+			// the sub calls are reverted too
+			continue
+		}
+		switch strings.ToUpper(sub.Type) {
+		case "CALL", "CREATE", "CREATE2", "SELFDESTRUCT":
+			if sub.To != nil && sub.Value != nil && sub.Value.ToInt().Sign() > 0 {
+				res = append(res, transfer{from: sub.From, to: *sub.To, value: sub.Value.ToInt()})
+			}
+		}
+		res = sub.internalTransfers(res)
+	}
+	return res
+}
+
+func callTraces(ctx context.Context, client *rpcclient.EvmClient, from, to uint64) ([][]*txTrace, error) {
+	type result struct {
+		Result *callFrame `json:"result"`
+		Error  string     `json:"error"`
+	}
+	blocks, err := batch[[]result](ctx, client, "debug_traceBlockByNumber", from, to, map[string]any{"tracer": "callTracer"})
+	if err != nil {
+		return nil, err
+	}
+	traces := make([][]*txTrace, len(blocks))
+	for i, results := range blocks {
+		for _, r := range results {
+			if r.Result == nil {
+				return nil, fmt.Errorf("trace of block %d failed, %s", from+uint64(i), r.Error)
+			}
+			trace := &txTrace{failed: r.Result.Error != ""}
+			if !trace.failed {
+				trace.transfers = r.Result.internalTransfers(nil)
+			}
+			traces[i] = append(traces[i], trace)
+		}
+	}
+	return traces, nil
+}
+
+// parityTrace the result of trace_block
+type parityTrace struct {
+	Action struct {
+		CallType      string          `json:"callType"`
+		From          common.Address  `json:"from"`
+		To            *common.Address `json:"to"`
+		Value         *hexutil.Big    `json:"value"`
+		Address       common.Address  `json:"address"`       // selfdestruct
+		RefundAddress common.Address  `json:"refundAddress"` // selfdestruct
+		Balance       *hexutil.Big    `json:"balance"`       // selfdestruct
+	} `json:"action"`
+	Result *struct {
+		Address *common.Address `json:"address"` // create
+	} `json:"result"`
+	Error               string `json:"error"`
+	TraceAddress        []int  `json:"traceAddress"`
+	TransactionPosition *int   `json:"transactionPosition"`
+	Type                string `json:"type"`
+}
+
+// transfer false if the trace does not transfer value
+func (t parityTrace) transfer() (transfer, bool) {
+	var res transfer
+	switch t.Type {
+	case "call":
+		if t.Action.CallType != "call" || t.Action.To == nil {
+			return res, false
+		}
+		res = transfer{from: t.Action.From, to: *t.Action.To, value: t.Action.Value.ToInt()}
+	case "create":
+		if t.Result == nil || t.Result.Address == nil {
+			return res, false
+		}
+		res = transfer{from: t.Action.From, to: *t.Result.Address, value: t.Action.Value.ToInt()}
+	case "suicide", "selfdestruct":
+		res = transfer{from: t.Action.Address, to: t.Action.RefundAddress, value: t.Action.Balance.ToInt()}
+	default:
+		return res, false
+	}
+	return res, res.value != nil && res.value.Sign() > 0
+}
+
+func parityTraces(ctx context.Context, client *rpcclient.EvmClient, from, to uint64) ([][]*txTrace, error) {
+	blocks, err := batch[[]parityTrace](ctx, client, "trace_block", from, to)
+	if err != nil {
+		return nil, err
+	}
+	traces := make([][]*txTrace, len(blocks))
+	for i, block := range blocks {
+		var reverted [][]int // trace addresses of the failed frames of the current transaction
+		for _, t := range block {
+			if t.TransactionPosition == nil {
+				continue // block reward
+			}
+			pos := *t.TransactionPosition
+			if pos >= len(traces[i]) {
+				for len(traces[i]) <= pos {
+					traces[i] = append(traces[i], &txTrace{})
+				}
+				reverted = nil
+			}
+			trace := traces[i][pos]
+
+			if t.Error != "" {
+				if len(t.TraceAddress) == 0 {
+					trace.failed = true
+				}
+				reverted = append(reverted, t.TraceAddress)
+				continue
+			}
+			if len(t.TraceAddress) == 0 || revertedBy(reverted, t.TraceAddress) {
+				continue
+			}
+			if tr, ok := t.transfer(); ok {
+				trace.transfers = append(trace.transfers, tr)
+			}
+		}
+	}
+	return traces, nil
+}
+
+// revertedBy the frame of addr is a sub call of a failed frame
+func revertedBy(reverted [][]int, addr []int) bool {
+	return slices.ContainsFunc(reverted, func(prefix []int) bool {
+		return len(prefix) < len(addr) && slices.Equal(prefix, addr[:len(prefix)])
+	})
+}
@@ -0,0 +1,96 @@
+package native
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	deposit  = common.HexToAddress("0xd0")
+	exchange = common.HexToAddress("0xe0")
+	other    = common.HexToAddress("0xf0")
+	wallet   = common.HexToAddress("0xc0") // contract wallet forwarding to deposit
+)
+
+func newTx(nonce uint64, to common.Address, value int64) *types.Transaction {
+	return types.NewTransaction(nonce, to, big.NewInt(value), 60000, big.NewInt(1), nil)
+}
+
+func call(from, to common.Address, value int64, err string, calls ...map[string]any) map[string]any {
+	return map[string]any{"type": "CALL", "from": from, "to": to, "value": (*hexutil.Big)(big.NewInt(value)), "error": err, "calls": calls}
+}
+
+func parity(pos int, traceAddress []int, from, to common.Address, value int64, err string) map[string]any {
+	return map[string]any{
+		"type":                "call",
+		"action":              map[string]any{"callType": "call", "from": from, "to": to, "value": (*hexutil.Big)(big.NewInt(value))},
+		"traceAddress":        traceAddress,
+		"transactionPosition": pos,
+		"error":               err,
+	}
+}
+
+func TestWatch(t *testing.T) {
+	txs := []*types.Transaction{newTx(0, deposit, 5), newTx(1, other, 7), newTx(2, deposit, 9), newTx(3, wallet, 0)}
+
+	for _, trace := range []Trace{TraceNone, TraceCallTracer, TraceParity} {
+		node := evmtest.NewNode(t, 1)
+		node.SetLatest(110)
+		node.AddTxs(101, evmtest.Tx{Transaction: txs[0], From: exchange}, evmtest.Tx{Transaction: txs[1], From: exchange})
+		node.AddTxs(102, evmtest.Tx{Transaction: txs[2], From: exchange, Failed: true})
+		node.AddTxs(103, evmtest.Tx{Transaction: txs[3], From: exchange})
+
+		// the wallet forwards 3 to the deposit address, the call of 4 is reverted
+		node.SetTraces("debug_traceBlockByNumber", 101, []any{
+			map[string]any{"result": call(exchange, deposit, 5, "")},
+			map[string]any{"result": call(exchange, other, 7, "")},
+		})
+		node.SetTraces("debug_traceBlockByNumber", 102, []any{map[string]any{"result": call(exchange, deposit, 9, "reverted")}})
+		node.SetTraces("debug_traceBlockByNumber", 103, []any{map[string]any{"result": call(exchange, wallet, 0, "",
+			call(wallet, deposit, 3, ""),
+			call(wallet, other, 0, "reverted", call(other, deposit, 4, "")),
+		)}})
+		node.SetTraces("trace_block", 101, []any{parity(0, []int{}, exchange, deposit, 5, ""), parity(1, []int{}, exchange, other, 7, "")})
+		node.SetTraces("trace_block", 102, []any{parity(0, []int{}, exchange, deposit, 9, "Reverted")})
+		node.SetTraces("trace_block", 103, []any{
+			parity(0, []int{}, exchange, wallet, 0, ""),
+			parity(0, []int{0}, wallet, deposit, 3, ""),
+			parity(0, []int{1}, wallet, other, 0, "Reverted"),
+			parity(0, []int{1, 0}, other, deposit, 4, ""),
+		})
+		client := node.Client(t)
+
+		n := New([]common.Address{deposit}, &abs.Attrs{ChainId: 1, ProcessedBlockNumber: 100}, trace)
+		var seen []string
+		n.AddEventHook(abs.AnyEvent, func(ctx context.Context, client *rpcclient.EvmClient, log types.Log) error {
+			e, _ := abs.EnvelopeFromContext(ctx)
+			v := e.Decoded.(Transfer)
+			seen = append(seen, fmt.Sprintf("%d/%d %x->%x %v internal=%v", log.BlockNumber, log.Index-abs.NativeLogIndexBase, v.From[19], v.To[19], v.Value, v.Internal))
+			if log.Address != deposit || EventToName(e.Event) == "" {
+				t.Fatalf("unexpected log: %+v", log)
+			}
+			return nil
+		})
+
+		if err := n.Scan(client); err != nil {
+			t.Fatal(err)
+		}
+		n.Close()
+		want := "[101/0 e0->d0 5 internal=false]"
+		if trace != TraceNone {
+			want = "[101/0 e0->d0 5 internal=false 103/0 c0->d0 3 internal=true]"
+		}
+		if fmt.Sprint(seen) != want || n.GetProcessedBlockNumber() != 110 {
+			t.Fatalf("trace %d: unexpected transfers %v", trace, seen)
+		}
+	}
+}
@@ -2,12 +2,19 @@ package sol
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"github.com/AcSunday/gwatch-chain/metrics"
 	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/AcSunday/gwatch-chain/tracing"
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type Event string
@@ -24,6 +31,21 @@ type Attrs struct {
 	ProcessedTxSignature solana.Signature
 	WatchBlockLimit      int                     // Limit the number of blocks scanned each time, default is 1000
 	ContractToDesc       map[string]ContractDesc // key is programId
+
+	// Commitment rpc.CommitmentConfirmed or rpc.CommitmentFinalized, default is finalized.
+	//  confirmed has lower latency, the handled transactions are checked until finalized,
+	//  see RegisterRollbackHook
+	Commitment rpc.CommitmentType
+
+	// Encoding solana.EncodingBase64 or solana.EncodingJSONParsed, default is base64.
+	//  jsonParsed transactions carry the parsed system/token instructions, see TxInfo.ParsedTxDetail
+	Encoding solana.EncodingType
+
+	Logger *slog.Logger // default is slog.Default()
+	// Name the watcher label of the metrics, default is the programId
+	Name string
+	// TracerProvider spans of scan cycles, rpc calls and hooks, default is otel.GetTracerProvider()
+	TracerProvider trace.TracerProvider
 }
 
 type ContractDesc struct {
@@ -33,11 +55,16 @@ type ContractDesc struct {
 }
 
 type TxInfo struct {
-	ProgramId  solana.PublicKey
-	TxSig      solana.Signature
-	TxDetail   *rpc.GetTransactionResult
-	DataBytes  []byte // ProgramData
-	EventIndex uint64 // ProgramData index
+	ProgramId solana.PublicKey
+	TxSig     solana.Signature
+	// TxDetail transaction is nil when jsonParsed, and Meta has no InnerInstructions and LoadedAddresses,
+	//  they are not in the parsed meta of solana-go, use ParsedTxDetail.Meta.InnerInstructions and
+	//  ParsedTxDetail.Transaction.Message.AccountKeys, which include the loaded addresses
+	TxDetail       *rpc.GetTransactionResult
+	ParsedTxDetail *rpc.GetParsedTransactionResult // set when Attrs.Encoding is jsonParsed
+	DataBytes      []byte                          // ProgramData
+	EventIndex     uint64                          // ProgramData index, only count the events emitted by ProgramId
+	InvokeDepth    int                             // invocation depth of ProgramId when emitted the event, top-level is 1
 }
 
 type Contract struct {
@@ -48,10 +75,16 @@ type Contract struct {
 	IsRunning atomic.Bool
 	IsClose   atomic.Bool
 
-	handleFunc map[Event]func(client *rpcclient.SolClient, txInfo TxInfo) error // key is event
-	mu         sync.RWMutex
-	ctx        context.Context
-	cancel     context.CancelFunc
+	handleFunc      hookRegistry[HookFunc]            // key is event, AnyEvent or unhandledEvent
+	instructionFunc hookRegistry[InstructionHookFunc] // key is instruction discriminator, AnyEvent or unhandledEvent
+	txFunc          hookRegistry[HookFunc]            // key is txHook, failedTxHook or rollbackHook
+	pendingTxs      []pendingTx                       // handled transactions are not finalized
+	finalizedTxSig  solana.Signature                  // latest handled transaction is finalized
+	tracer          trace.Tracer
+	watcher         string // metrics label, see Attrs.Name
+	mu              sync.RWMutex
+	ctx             context.Context
+	cancel          context.CancelFunc
 }
 
 func New(programId string, attrs *Attrs) (*Contract, error) {
@@ -63,6 +96,16 @@ func New(programId string, attrs *Attrs) (*Contract, error) {
 	if attrs.ProcessedTxSignature.IsZero() {
 		return nil, errors.New("invalid processed tx signature, can set the earliest transaction signature to start")
 	}
+	switch attrs.Commitment {
+	case "", rpc.CommitmentConfirmed, rpc.CommitmentFinalized:
+	default:
+		return nil, fmt.Errorf("unsupported commitment %s, only confirmed or finalized", attrs.Commitment)
+	}
+	switch attrs.Encoding {
+	case "", solana.EncodingBase64, solana.EncodingBase64Zstd, solana.EncodingBase58, solana.EncodingJSONParsed:
+	default:
+		return nil, fmt.Errorf("unsupported encoding %s", attrs.Encoding)
+	}
 
 	c := &Contract{
 		ProgramId: proId,
@@ -72,12 +115,26 @@ func New(programId string, attrs *Attrs) (*Contract, error) {
 }
 
 func (c *Contract) Init(attrs Attrs) {
-	c.handleFunc = make(map[Event]func(client *rpcclient.SolClient, txInfo TxInfo) error, 4)
+	c.handleFunc = hookRegistry[HookFunc]{}
+	c.instructionFunc = hookRegistry[InstructionHookFunc]{}
+	c.txFunc = hookRegistry[HookFunc]{}
 
 	c.Attrs = attrs
 	if c.WatchBlockLimit <= 0 {
 		c.WatchBlockLimit = DefaultWatchLimit
 	}
+	if c.Commitment == "" {
+		c.Commitment = rpc.CommitmentFinalized
+	}
+	if c.Encoding == "" {
+		c.Encoding = solana.EncodingBase64
+	}
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	c.tracer = tracing.Tracer(c.TracerProvider)
+	c.watcher = metrics.WatcherLabel(c.Name, c.ProgramId.String())
+	c.finalizedTxSig = c.ProcessedTxSignature
 
 	c.IsRunning.Store(true)
 	c.IsClose.Store(false)
@@ -94,6 +151,11 @@ func (c *Contract) Close() error {
 	return nil
 }
 
+// Context is cancelled when the contract is closed
+func (c *Contract) Context() context.Context {
+	return c.ctx
+}
+
 func (c *Contract) DoneSignal() <-chan struct{} {
 	if c.IsRunning.Load() && !c.IsClose.Load() {
 		return c.ctx.Done()
@@ -101,28 +163,208 @@ func (c *Contract) DoneSignal() <-chan struct{} {
 	return nil
 }
 
-// RegisterEventHook Hook is a function that handles event,
+// RegisterEventHook Hook is a function that handles event, the hooks of an event are called in order of registration,
 // HandleEvent method call this Hook
 func (c *Contract) RegisterEventHook(event Event, f func(client *rpcclient.SolClient, txInfo TxInfo) error) error {
-	if c.IsClose.Load() {
-		return errors.New("already closed, Registration of event hook is prohibited")
-	}
-	c.mu.Lock()
-	c.handleFunc[event] = f
-	c.mu.Unlock()
-	return nil
+	return c.RegisterEventHookContext(event, AdaptHook(f))
+}
+
+// RegisterEventHookContext Hook receives the context of the scan, see HookFunc,
+// HandleEvent method call this Hook
+func (c *Contract) RegisterEventHookContext(event Event, f HookFunc) error {
+	_, err := c.AddEventHook(event, f)
+	return err
+}
+
+// AddEventHook appends the Hook of event and returns the handle to remove it,
+// the Hook of AnyEvent is called for every event after the hooks of the event
+func (c *Contract) AddEventHook(event Event, f HookFunc) (Unregister, error) {
+	return addHook(c, &c.handleFunc, event, f, "event")
+}
+
+// AddUnhandledEventHook Hook of the events emitted by ProgramId without Hook, the catch-all hooks are still called
+func (c *Contract) AddUnhandledEventHook(f HookFunc) (Unregister, error) {
+	return addHook(c, &c.handleFunc, unhandledEvent, f, "event")
 }
 
 // HandleEvent method call Hook
 func (c *Contract) HandleEvent(client *rpcclient.SolClient, event Event, txInfo TxInfo) error {
+	return c.callEvent(c.ctx, client, event, txInfo)
+}
+
+func (c *Contract) callEvent(ctx context.Context, client *rpcclient.SolClient, event Event, txInfo TxInfo) error {
 	if !c.IsRunning.Load() {
 		return errors.New("not running, handle event is prohibited")
 	}
 
+	// hooks are called without the lock, they may register or unregister hooks
 	c.mu.RLock()
-	defer c.mu.RUnlock()
-	if f, ok := c.handleFunc[event]; ok {
-		return f(client, txInfo)
+	hooks := c.handleFunc.dispatch(event)
+	c.mu.RUnlock()
+	for _, f := range hooks {
+		err := c.runHook(ctx, "event:"+hex.EncodeToString([]byte(event)), txInfo.TxSig, func(ctx context.Context) error {
+			return f(ctx, client, txInfo)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterInstructionHook Hook is a function that handles instruction of ProgramId,
+// both top-level and inner (CPI) instructions, HandleInstruction method call this Hook
+//
+//	instruction: InstructionEvent("instruct_name")
+func (c *Contract) RegisterInstructionHook(instruction Event, f func(client *rpcclient.SolClient, ixInfo InstructionInfo) error) error {
+	return c.RegisterInstructionHookContext(instruction, AdaptInstructionHook(f))
+}
+
+// RegisterInstructionHookContext instruction Hook receives the context of the scan, see HookFunc,
+// HandleInstruction method call this Hook
+func (c *Contract) RegisterInstructionHookContext(instruction Event, f InstructionHookFunc) error {
+	_, err := c.AddInstructionHook(instruction, f)
+	return err
+}
+
+// AddInstructionHook appends the Hook of instruction and returns the handle to remove it,
+// the Hook of AnyEvent is called for every instruction after the hooks of the instruction
+func (c *Contract) AddInstructionHook(instruction Event, f InstructionHookFunc) (Unregister, error) {
+	return addHook(c, &c.instructionFunc, instruction, f, "instruction")
+}
+
+// AddUnhandledInstructionHook Hook of the instructions of ProgramId without Hook, the catch-all hooks are still called
+func (c *Contract) AddUnhandledInstructionHook(f InstructionHookFunc) (Unregister, error) {
+	return addHook(c, &c.instructionFunc, unhandledEvent, f, "instruction")
+}
+
+// HandleInstruction method call instruction Hook
+func (c *Contract) HandleInstruction(client *rpcclient.SolClient, instruction Event, ixInfo InstructionInfo) error {
+	return c.callInstruction(c.ctx, client, instruction, ixInfo)
+}
+
+func (c *Contract) callInstruction(ctx context.Context, client *rpcclient.SolClient, instruction Event, ixInfo InstructionInfo) error {
+	if !c.IsRunning.Load() {
+		return errors.New("not running, handle instruction is prohibited")
+	}
+
+	c.mu.RLock()
+	hooks := c.instructionFunc.dispatch(instruction)
+	c.mu.RUnlock()
+	for _, f := range hooks {
+		err := c.runHook(ctx, "instruction:"+hex.EncodeToString([]byte(instruction)), ixInfo.TxSig, func(ctx context.Context) error {
+			return f(ctx, client, ixInfo)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterTxHook Hook is a function that handles every transaction of ProgramId,
+// HandleTx method call this Hook
+func (c *Contract) RegisterTxHook(f func(client *rpcclient.SolClient, txInfo TxInfo) error) error {
+	return c.RegisterTxHookContext(AdaptHook(f))
+}
+
+// RegisterTxHookContext tx Hook receives the context of the scan, see HookFunc,
+// HandleTx method call this Hook
+func (c *Contract) RegisterTxHookContext(f HookFunc) error {
+	_, err := c.AddTxHook(f)
+	return err
+}
+
+// AddTxHook appends the tx Hook and returns the handle to remove it
+func (c *Contract) AddTxHook(f HookFunc) (Unregister, error) {
+	return addHook(c, &c.txFunc, txHook, f, "tx")
+}
+
+// HandleTx method call tx Hook
+func (c *Contract) HandleTx(client *rpcclient.SolClient, txInfo TxInfo) error {
+	return c.callTx(c.ctx, client, txInfo)
+}
+
+func (c *Contract) callTx(ctx context.Context, client *rpcclient.SolClient, txInfo TxInfo) error {
+	if !c.IsRunning.Load() {
+		return errors.New("not running, handle tx is prohibited")
+	}
+	return c.callTxHooks(ctx, client, txHook, txInfo)
+}
+
+// RegisterFailedTxHook Hook is a function that handles failed transaction of ProgramId,
+// failed transactions are skipped by default, HandleFailedTx method call this Hook
+func (c *Contract) RegisterFailedTxHook(f func(client *rpcclient.SolClient, txInfo TxInfo) error) error {
+	return c.RegisterFailedTxHookContext(AdaptHook(f))
+}
+
+// RegisterFailedTxHookContext failed tx Hook receives the context of the scan, see HookFunc,
+// HandleFailedTx method call this Hook
+func (c *Contract) RegisterFailedTxHookContext(f HookFunc) error {
+	_, err := c.AddFailedTxHook(f)
+	return err
+}
+
+// AddFailedTxHook appends the failed tx Hook and returns the handle to remove it
+func (c *Contract) AddFailedTxHook(f HookFunc) (Unregister, error) {
+	return addHook(c, &c.txFunc, failedTxHook, f, "failed tx")
+}
+
+// HandleFailedTx method call failed tx Hook
+func (c *Contract) HandleFailedTx(client *rpcclient.SolClient, txInfo TxInfo) error {
+	return c.callFailedTx(c.ctx, client, txInfo)
+}
+
+func (c *Contract) callFailedTx(ctx context.Context, client *rpcclient.SolClient, txInfo TxInfo) error {
+	if !c.IsRunning.Load() {
+		return errors.New("not running, handle failed tx is prohibited")
+	}
+	return c.callTxHooks(ctx, client, failedTxHook, txInfo)
+}
+
+// RegisterRollbackHook Hook is a function that handles the confirmed transaction
+// which has been handled but disappeared before finalized, txInfo.TxDetail is nil,
+// only works with rpc.CommitmentConfirmed, HandleRollback method call this Hook
+func (c *Contract) RegisterRollbackHook(f func(client *rpcclient.SolClient, txInfo TxInfo) error) error {
+	return c.RegisterRollbackHookContext(AdaptHook(f))
+}
+
+// RegisterRollbackHookContext rollback Hook receives the context of the scan, see HookFunc,
+// HandleRollback method call this Hook
+func (c *Contract) RegisterRollbackHookContext(f HookFunc) error {
+	_, err := c.AddRollbackHook(f)
+	return err
+}
+
+// AddRollbackHook appends the rollback Hook and returns the handle to remove it
+func (c *Contract) AddRollbackHook(f HookFunc) (Unregister, error) {
+	return addHook(c, &c.txFunc, rollbackHook, f, "rollback")
+}
+
+// HandleRollback method call rollback Hook
+func (c *Contract) HandleRollback(client *rpcclient.SolClient, txInfo TxInfo) error {
+	return c.callRollback(c.ctx, client, txInfo)
+}
+
+func (c *Contract) callRollback(ctx context.Context, client *rpcclient.SolClient, txInfo TxInfo) error {
+	if !c.IsRunning.Load() {
+		return errors.New("not running, handle rollback is prohibited")
+	}
+	return c.callTxHooks(ctx, client, rollbackHook, txInfo)
+}
+
+// callTxHooks the tx, failed tx or rollback hooks in order
+func (c *Contract) callTxHooks(ctx context.Context, client *rpcclient.SolClient, key Event, txInfo TxInfo) error {
+	c.mu.RLock()
+	hooks := c.txFunc.get(key)
+	c.mu.RUnlock()
+	for _, f := range hooks {
+		err := c.runHook(ctx, string(key), txInfo.TxSig, func(ctx context.Context) error {
+			return f(ctx, client, txInfo)
+		})
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -150,6 +392,25 @@ func (c *Contract) GetContractDesc(programId string) (ContractDesc, error) {
 	return v, nil
 }
 
+// logger with the chain and program fields
+func (c *Contract) logger() *slog.Logger {
+	return c.Logger.With("chain_id", c.ChainId, "chain", c.Chain, "program_id", c.ProgramId)
+}
+
+// runHook reports the metrics and the span of the hook, the event label is hex encoded, the discriminator is not utf-8
+func (c *Contract) runHook(ctx context.Context, event string, txSig solana.Signature, f func(ctx context.Context) error) error {
+	ctx, span := c.tracer.Start(ctx, tracing.HookSpan, trace.WithAttributes(
+		tracing.EventKey.String(event),
+		tracing.ProgramIdKey.String(c.ProgramId.String()),
+		tracing.TxSigKey.String(txSig.String()),
+	))
+	start := time.Now()
+	err := f(ctx)
+	metrics.Default().Hook(metrics.ChainLabel(c.Chain, c.ChainId), c.watcher, event, time.Since(start), err)
+	tracing.End(span, err)
+	return err
+}
+
 func (e Event) String() string {
 	return string(e)
 }
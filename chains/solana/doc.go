@@ -0,0 +1,7 @@
+// Package sol scans the transactions of solana programs and calls the registered hooks.
+//
+// Failed transactions are skipped by default, see RegisterFailedTxHook.
+// With rpc.CommitmentConfirmed the handled transactions are checked until finalized,
+// a transaction which disappears before finalized is passed to the RegisterRollbackHook hooks
+// and ProcessedTxSignature moves back to the newest surviving transaction.
+package sol
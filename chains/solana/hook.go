@@ -0,0 +1,150 @@
+package sol
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/gagliardetto/solana-go"
+)
+
+// HookFunc context-aware Hook of event, tx, failed tx and rollback, ctx is cancelled when the contract is closed,
+// it carries the span of the hook and the ScanInfo of the scan cycle
+type HookFunc func(ctx context.Context, client *rpcclient.SolClient, txInfo TxInfo) error
+
+// InstructionHookFunc context-aware Hook of instruction, see HookFunc
+type InstructionHookFunc func(ctx context.Context, client *rpcclient.SolClient, ixInfo InstructionInfo) error
+
+// AdaptHook the Hook without context as a HookFunc
+func AdaptHook(f func(client *rpcclient.SolClient, txInfo TxInfo) error) HookFunc {
+	return func(ctx context.Context, client *rpcclient.SolClient, txInfo TxInfo) error {
+		return f(client, txInfo)
+	}
+}
+
+// AdaptInstructionHook the instruction Hook without context as an InstructionHookFunc
+func AdaptInstructionHook(f func(client *rpcclient.SolClient, ixInfo InstructionInfo) error) InstructionHookFunc {
+	return func(ctx context.Context, client *rpcclient.SolClient, ixInfo InstructionInfo) error {
+		return f(client, ixInfo)
+	}
+}
+
+// ScanInfo metadata of the scan cycle which calls the Hook,
+// the slots are zero when checking the pending transactions, see RegisterRollbackHook
+type ScanInfo struct {
+	ChainId   uint64
+	Chain     string
+	ProgramId solana.PublicKey
+	Until     solana.Signature // processed tx signature before the scan
+	FromSlot  uint64
+	ToSlot    uint64
+	Node      string // scheme://host of the rpc node, see metrics.NodeLabel
+}
+
+type scanInfoKey struct{}
+
+// WithScanInfo returns a copy of ctx carrying info
+func WithScanInfo(ctx context.Context, info ScanInfo) context.Context {
+	return context.WithValue(ctx, scanInfoKey{}, info)
+}
+
+// ScanInfoFromContext the ScanInfo of the scan cycle, false if the Hook is not called by Scan
+func ScanInfoFromContext(ctx context.Context) (ScanInfo, bool) {
+	info, ok := ctx.Value(scanInfoKey{}).(ScanInfo)
+	return info, ok
+}
+
+// AnyEvent the catch-all Hook of AddEventHook and AddInstructionHook,
+// it is called for every event or instruction after the hooks of it
+const AnyEvent Event = "*"
+
+// keys of the hook registries, also the event labels of metrics and spans
+const (
+	unhandledEvent Event = ""
+	txHook         Event = "tx"
+	failedTxHook   Event = "failed_tx"
+	rollbackHook   Event = "rollback"
+)
+
+// Unregister removes the Hook, calling it again has no effect
+type Unregister func()
+
+type hookEntry[F any] struct {
+	id uint64
+	f  F
+}
+
+// hookRegistry ordered hooks by key, guarded by Contract.mu
+type hookRegistry[F any] struct {
+	seq     uint64
+	entries map[Event][]hookEntry[F]
+}
+
+func (r *hookRegistry[F]) add(key Event, f F) uint64 {
+	if r.entries == nil {
+		r.entries = make(map[Event][]hookEntry[F], 4)
+	}
+	r.seq++
+	r.entries[key] = append(r.entries[key], hookEntry[F]{id: r.seq, f: f})
+	return r.seq
+}
+
+func (r *hookRegistry[F]) remove(key Event, id uint64) {
+	entries := r.entries[key]
+	for i, e := range entries {
+		if e.id == id {
+			r.entries[key] = append(entries[:i:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(r.entries[key]) == 0 {
+		delete(r.entries, key)
+	}
+}
+
+// get copy of the hooks of key
+func (r *hookRegistry[F]) get(key Event) []F {
+	entries := r.entries[key]
+	fs := make([]F, len(entries))
+	for i, e := range entries {
+		fs[i] = e.f
+	}
+	return fs
+}
+
+// dispatch the hooks of event, or the unhandled hooks if event has no hook, followed by the catch-all hooks
+func (r *hookRegistry[F]) dispatch(event Event) []F {
+	key := event
+	if len(r.entries[event]) == 0 {
+		key = unhandledEvent
+	}
+	return append(r.get(key), r.get(AnyEvent)...)
+}
+
+func (r *hookRegistry[F]) has(key Event) bool {
+	return len(r.entries[key]) > 0
+}
+
+func (r *hookRegistry[F]) empty() bool {
+	return len(r.entries) == 0
+}
+
+// addHook appends the Hook of key to r and returns the handle to remove it
+func addHook[F any](c *Contract, r *hookRegistry[F], key Event, f F, kind string) (Unregister, error) {
+	if c.IsClose.Load() {
+		return nil, fmt.Errorf("already closed, Registration of %s hook is prohibited", kind)
+	}
+	c.mu.Lock()
+	id := r.add(key, f)
+	c.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			r.remove(key, id)
+			c.mu.Unlock()
+		})
+	}, nil
+}
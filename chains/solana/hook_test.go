@@ -0,0 +1,53 @@
+package sol
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestHooks(t *testing.T) {
+	contract, err := New(solana.NewWallet().PublicKey().String(), &Attrs{ProcessedTxSignature: solana.Signature{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer contract.Close()
+
+	var calls []string
+	hook := func(name string) HookFunc {
+		return func(ctx context.Context, client *rpcclient.SolClient, txInfo TxInfo) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	assertCalls := func(f func() error, expected string) {
+		t.Helper()
+		calls = nil
+		if err := f(); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(calls, ",") != expected {
+			t.Fatalf("unexpected calls: %v", calls)
+		}
+	}
+
+	swap, deposit := InstructionEvent("swap"), InstructionEvent("deposit")
+	contract.RegisterEventHookContext(swap, hook("first"))
+	unregister, _ := contract.AddEventHook(swap, hook("second"))
+	contract.AddEventHook(AnyEvent, hook("any"))
+	contract.AddUnhandledEventHook(hook("unhandled"))
+	assertCalls(func() error { return contract.HandleEvent(nil, swap, TxInfo{}) }, "first,second,any")
+	assertCalls(func() error { return contract.HandleEvent(nil, deposit, TxInfo{}) }, "unhandled,any")
+	unregister()
+	assertCalls(func() error { return contract.HandleEvent(nil, swap, TxInfo{}) }, "first,any")
+
+	contract.RegisterTxHookContext(hook("tx1"))
+	unregister, _ = contract.AddTxHook(hook("tx2"))
+	assertCalls(func() error { return contract.HandleTx(nil, TxInfo{}) }, "tx1,tx2")
+	unregister()
+	assertCalls(func() error { return contract.HandleTx(nil, TxInfo{}) }, "tx1")
+	assertCalls(func() error { return contract.HandleRollback(nil, TxInfo{}) }, "")
+}
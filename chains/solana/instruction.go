@@ -0,0 +1,343 @@
+package sol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/AcSunday/gwatch-chain/utils"
+	"github.com/gagliardetto/solana-go"
+	addresslookuptable "github.com/gagliardetto/solana-go/programs/address-lookup-table"
+	"github.com/gagliardetto/solana-go/rpc"
+	"time"
+)
+
+// TopLevelInstruction InnerIndex of an instruction that is not a CPI
+const TopLevelInstruction = -1
+
+type InstructionInfo struct {
+	ProgramId        solana.PublicKey
+	TxSig            solana.Signature
+	TxDetail         *rpc.GetTransactionResult
+	InstructionIndex uint16                 // index of the top-level instruction
+	InnerIndex       int                    // index in the inner instructions of InstructionIndex, TopLevelInstruction if not inner
+	Accounts         []solana.PublicKey     // resolved account keys, including address lookup tables
+	DataBytes        []byte                 // instruction data, starts with the 8 bytes discriminator
+	Parsed           *rpc.ParsedInstruction // set when the transaction is jsonParsed
+}
+
+// IsInner the instruction is invoked by CPI
+func (i InstructionInfo) IsInner() bool {
+	return i.InnerIndex != TopLevelInstruction
+}
+
+// ParsedInfo the parsed instruction of system/token programs etc. when the transaction is jsonParsed,
+// returns nil if the node has no parser for the program
+func (i InstructionInfo) ParsedInfo() (*rpc.InstructionInfo, error) {
+	if i.Parsed == nil || i.Parsed.Parsed == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(i.Parsed.Parsed)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || data[0] != '{' {
+		return &rpc.InstructionInfo{InstructionType: string(data)}, nil
+	}
+	info := &rpc.InstructionInfo{}
+	if err = json.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// InstructionEvent instruction discriminator, same as utils.SigHash
+//
+//	instructName case: mint_voucher
+func InstructionEvent(instructName string) Event {
+	methodHash := utils.SigHash(instructName)
+	return Event(methodHash[:])
+}
+
+// handleInstructions call instruction hooks for top-level and inner instructions targeting ProgramId
+func (c *Contract) handleInstructions(ctx context.Context, client *rpcclient.SolClient, txInfo TxInfo) error {
+	c.mu.RLock()
+	hasHook := !c.instructionFunc.empty()
+	c.mu.RUnlock()
+	if !hasHook {
+		return nil
+	}
+
+	ixs, err := txInfo.Instructions(client, c.ProgramId)
+	if err != nil {
+		return fmt.Errorf("txSig: %v, %v", txInfo.TxSig, err)
+	}
+	for _, ix := range ixs {
+		if len(ix.DataBytes) < 8 {
+			continue
+		}
+
+		err = c.callInstruction(ctx, client, Event(ix.DataBytes[:8]), ix)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Instructions returns the top-level and inner instructions targeting programIds in execution order,
+// the account keys of the instructions are resolved, including address lookup tables of v0 transactions
+func (t TxInfo) Instructions(client *rpcclient.SolClient, programIds ...solana.PublicKey) ([]InstructionInfo, error) {
+	var ixs []InstructionInfo
+	if t.ParsedTxDetail != nil {
+		ixs = collectParsedInstructions(programIds, t.ParsedTxDetail)
+	} else {
+		if t.TxDetail == nil || t.TxDetail.Transaction == nil {
+			return nil, nil
+		}
+
+		tx, err := t.TxDetail.Transaction.GetTransaction()
+		if err != nil {
+			return nil, fmt.Errorf("decode transaction failed, %v", err)
+		}
+		accountKeys, err := resolveAccountKeys(client, tx, t.TxDetail.Meta)
+		if err != nil {
+			return nil, fmt.Errorf("resolve account keys failed, %v", err)
+		}
+		ixs = collectInstructions(programIds, tx, t.TxDetail.Meta, accountKeys)
+	}
+
+	for i := range ixs {
+		ixs[i].TxSig = t.TxSig
+		ixs[i].TxDetail = t.TxDetail
+	}
+	return ixs, nil
+}
+
+// AccountKeys returns all account keys of the transaction, the index is same as the
+// instruction accounts and the AccountIndex of token balances
+func (t TxInfo) AccountKeys(client *rpcclient.SolClient) (solana.PublicKeySlice, error) {
+	if t.ParsedTxDetail != nil {
+		keys := make(solana.PublicKeySlice, 0, len(t.ParsedTxDetail.Transaction.Message.AccountKeys))
+		for _, acc := range t.ParsedTxDetail.Transaction.Message.AccountKeys {
+			keys = append(keys, acc.PublicKey)
+		}
+		return keys, nil
+	}
+	if t.TxDetail == nil || t.TxDetail.Transaction == nil {
+		return nil, errors.New("transaction is nil")
+	}
+
+	tx, err := t.TxDetail.Transaction.GetTransaction()
+	if err != nil {
+		return nil, fmt.Errorf("decode transaction failed, %v", err)
+	}
+	return resolveAccountKeys(client, tx, t.TxDetail.Meta)
+}
+
+// ParseInstructions returns the instructions of txDetail targeting programIds, see TxInfo.Instructions
+func ParseInstructions(client *rpcclient.SolClient, txDetail *rpc.GetTransactionResult, programIds ...solana.PublicKey) ([]InstructionInfo, error) {
+	txInfo := TxInfo{TxDetail: txDetail}
+	if txDetail != nil && txDetail.Transaction != nil {
+		tx, err := txDetail.Transaction.GetTransaction()
+		if err != nil {
+			return nil, fmt.Errorf("decode transaction failed, %v", err)
+		}
+		if len(tx.Signatures) > 0 {
+			txInfo.TxSig = tx.Signatures[0]
+		}
+	}
+	return txInfo.Instructions(client, programIds...)
+}
+
+// ResolveAccountKeys returns all account keys of txDetail, see TxInfo.AccountKeys
+func ResolveAccountKeys(client *rpcclient.SolClient, txDetail *rpc.GetTransactionResult) (solana.PublicKeySlice, error) {
+	return TxInfo{TxDetail: txDetail}.AccountKeys(client)
+}
+
+// ParsedMessage returns the message in jsonParsed layout regardless of the encoding fetched,
+// instructions of base64 transactions are not parsed, only the program id, accounts and data are set
+func (t TxInfo) ParsedMessage() (*rpc.ParsedMessage, error) {
+	if t.ParsedTxDetail != nil {
+		return &t.ParsedTxDetail.Transaction.Message, nil
+	}
+	if t.TxDetail == nil || t.TxDetail.Transaction == nil {
+		return nil, errors.New("transaction is nil")
+	}
+
+	tx, err := t.TxDetail.Transaction.GetTransaction()
+	if err != nil {
+		return nil, fmt.Errorf("decode transaction failed, %v", err)
+	}
+	accountKeys, err := resolveAccountKeys(nil, tx, t.TxDetail.Meta)
+	if err != nil {
+		return nil, fmt.Errorf("resolve account keys failed, %v", err)
+	}
+	// the keys loaded from address lookup tables are writable first, then readonly
+	numStatic := len(tx.Message.AccountKeys)
+	numWritableLoaded := tx.Message.NumWritableLookups()
+
+	msg := &rpc.ParsedMessage{
+		AccountKeys:     make([]rpc.ParsedMessageAccount, 0, len(accountKeys)),
+		Instructions:    make([]*rpc.ParsedInstruction, 0, len(tx.Message.Instructions)),
+		RecentBlockHash: tx.Message.RecentBlockhash.String(),
+	}
+	for i, key := range accountKeys {
+		writable := i >= numStatic && i < numStatic+numWritableLoaded
+		if i < numStatic {
+			writable, _ = tx.Message.IsWritable(key)
+		}
+		msg.AccountKeys = append(msg.AccountKeys, rpc.ParsedMessageAccount{
+			PublicKey: key,
+			Signer:    i < int(tx.Message.Header.NumRequiredSignatures),
+			Writable:  writable,
+		})
+	}
+	for _, ix := range tx.Message.Instructions {
+		parsed := &rpc.ParsedInstruction{Data: ix.Data, StackHeight: 1}
+		if int(ix.ProgramIDIndex) < len(accountKeys) {
+			parsed.ProgramId = accountKeys[ix.ProgramIDIndex]
+		}
+		for _, accIdx := range ix.Accounts {
+			if int(accIdx) < len(accountKeys) {
+				parsed.Accounts = append(parsed.Accounts, accountKeys[accIdx])
+			}
+		}
+		msg.Instructions = append(msg.Instructions, parsed)
+	}
+	return msg, nil
+}
+
+// collectInstructions returns the instructions of programIds in execution order,
+// every top-level instruction is followed by its inner instructions
+func collectInstructions(programIds []solana.PublicKey, tx *solana.Transaction, meta *rpc.TransactionMeta, accountKeys solana.PublicKeySlice) []InstructionInfo {
+	inners := make(map[uint16][]solana.CompiledInstruction)
+	if meta != nil {
+		for _, inner := range meta.InnerInstructions {
+			inners[inner.Index] = append(inners[inner.Index], inner.Instructions...)
+		}
+	}
+
+	res := make([]InstructionInfo, 0, len(tx.Message.Instructions))
+	for i, ix := range tx.Message.Instructions {
+		idx := uint16(i)
+		if info, ok := toInstructionInfo(programIds, ix, accountKeys); ok {
+			info.InstructionIndex = idx
+			info.InnerIndex = TopLevelInstruction
+			res = append(res, info)
+		}
+
+		for j, innerIx := range inners[idx] {
+			if info, ok := toInstructionInfo(programIds, innerIx, accountKeys); ok {
+				info.InstructionIndex = idx
+				info.InnerIndex = j
+				res = append(res, info)
+			}
+		}
+	}
+	return res
+}
+
+// collectParsedInstructions same as collectInstructions for jsonParsed transaction
+func collectParsedInstructions(programIds []solana.PublicKey, parsed *rpc.GetParsedTransactionResult) []InstructionInfo {
+	inners := make(map[uint64][]*rpc.ParsedInstruction)
+	if parsed.Meta != nil {
+		for _, inner := range parsed.Meta.InnerInstructions {
+			inners[inner.Index] = append(inners[inner.Index], inner.Instructions...)
+		}
+	}
+
+	toInfo := func(ix *rpc.ParsedInstruction) (InstructionInfo, bool) {
+		if ix == nil || !solana.PublicKeySlice(programIds).Contains(ix.ProgramId) {
+			return InstructionInfo{}, false
+		}
+		return InstructionInfo{
+			ProgramId: ix.ProgramId,
+			Accounts:  ix.Accounts,
+			DataBytes: ix.Data,
+			Parsed:    ix,
+		}, true
+	}
+
+	res := make([]InstructionInfo, 0, len(parsed.Transaction.Message.Instructions))
+	for i, ix := range parsed.Transaction.Message.Instructions {
+		if info, ok := toInfo(ix); ok {
+			info.InstructionIndex = uint16(i)
+			info.InnerIndex = TopLevelInstruction
+			res = append(res, info)
+		}
+
+		for j, innerIx := range inners[uint64(i)] {
+			if info, ok := toInfo(innerIx); ok {
+				info.InstructionIndex = uint16(i)
+				info.InnerIndex = j
+				res = append(res, info)
+			}
+		}
+	}
+	return res
+}
+
+func toInstructionInfo(programIds []solana.PublicKey, ix solana.CompiledInstruction, accountKeys solana.PublicKeySlice) (InstructionInfo, bool) {
+	if int(ix.ProgramIDIndex) >= len(accountKeys) {
+		return InstructionInfo{}, false
+	}
+	programId := accountKeys[ix.ProgramIDIndex]
+	if !solana.PublicKeySlice(programIds).Contains(programId) {
+		return InstructionInfo{}, false
+	}
+
+	accounts := make([]solana.PublicKey, 0, len(ix.Accounts))
+	for _, accIdx := range ix.Accounts {
+		if int(accIdx) >= len(accountKeys) {
+			return InstructionInfo{}, false
+		}
+		accounts = append(accounts, accountKeys[accIdx])
+	}
+	return InstructionInfo{
+		ProgramId: programId,
+		Accounts:  accounts,
+		DataBytes: ix.Data,
+	}, true
+}
+
+// resolveAccountKeys static account keys + writable + readonly keys loaded from address lookup tables,
+// the loaded addresses of the meta are preferred, the tables are fetched when the node does not return them
+func resolveAccountKeys(client *rpcclient.SolClient, tx *solana.Transaction, meta *rpc.TransactionMeta) (solana.PublicKeySlice, error) {
+	keys := make(solana.PublicKeySlice, 0, len(tx.Message.AccountKeys))
+	keys = append(keys, tx.Message.AccountKeys...)
+	if !tx.Message.IsVersioned() || tx.Message.NumLookups() == 0 {
+		return keys, nil
+	}
+
+	if meta != nil && len(meta.LoadedAddresses.Writable)+len(meta.LoadedAddresses.ReadOnly) > 0 {
+		keys = append(keys, meta.LoadedAddresses.Writable...)
+		keys = append(keys, meta.LoadedAddresses.ReadOnly...)
+		return keys, nil
+	}
+	if client == nil {
+		return nil, errors.New("address lookup tables are not loaded")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tables := make(map[solana.PublicKey]solana.PublicKeySlice, tx.Message.NumLookups())
+	for _, tableId := range tx.Message.GetAddressTableLookups().GetTableIDs() {
+		state, err := addresslookuptable.GetAddressLookupTable(ctx, client.Client, tableId)
+		if err != nil {
+			return nil, fmt.Errorf("get address lookup table %v failed, %v", tableId, err)
+		}
+		tables[tableId] = state.Addresses
+	}
+	if err := tx.Message.SetAddressTables(tables); err != nil {
+		return nil, err
+	}
+	loaded, err := tx.Message.GetAddressTableLookupAccounts()
+	if err != nil {
+		return nil, err
+	}
+	return append(keys, loaded...), nil
+}
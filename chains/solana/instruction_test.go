@@ -0,0 +1,109 @@
+package sol
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+func TestCollectInstructions(t *testing.T) {
+	payer := solana.NewWallet().PublicKey()
+	programId := solana.NewWallet().PublicKey()
+	otherProgram := solana.NewWallet().PublicKey()
+	tableId := solana.NewWallet().PublicKey()
+	writable := solana.NewWallet().PublicKey()
+	readonly := solana.NewWallet().PublicKey()
+
+	mintVoucher := InstructionEvent("mint_voucher")
+	data := append([]byte(mintVoucher), 1, 2, 3)
+
+	tx := &solana.Transaction{
+		Message: solana.Message{
+			AccountKeys: solana.PublicKeySlice{payer, programId, otherProgram},
+			Instructions: []solana.CompiledInstruction{
+				{ProgramIDIndex: 1, Accounts: []uint16{0, 3}, Data: data},
+				{ProgramIDIndex: 2, Accounts: []uint16{0, 4}, Data: []byte{9}},
+			},
+			AddressTableLookups: solana.MessageAddressTableLookupSlice{
+				{AccountKey: tableId, WritableIndexes: []uint8{0}, ReadonlyIndexes: []uint8{1}},
+			},
+		},
+	}
+	tx.Message.SetVersion(solana.MessageVersionV0)
+	meta := &rpc.TransactionMeta{
+		LoadedAddresses: rpc.LoadedAddresses{
+			Writable: solana.PublicKeySlice{writable},
+			ReadOnly: solana.PublicKeySlice{readonly},
+		},
+		InnerInstructions: []rpc.InnerInstruction{
+			{Index: 1, Instructions: []solana.CompiledInstruction{
+				{ProgramIDIndex: 1, Accounts: []uint16{4}, Data: data},
+			}},
+		},
+	}
+
+	keys, err := resolveAccountKeys(nil, tx, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 5 || !keys[3].Equals(writable) || !keys[4].Equals(readonly) {
+		t.Fatalf("unexpected account keys: %v", keys)
+	}
+
+	ixs := collectInstructions([]solana.PublicKey{programId}, tx, meta, keys)
+	if len(ixs) != 2 {
+		t.Fatalf("expected 2 instructions, got %d", len(ixs))
+	}
+	if ixs[0].IsInner() || ixs[0].InstructionIndex != 0 || !ixs[0].Accounts[1].Equals(writable) {
+		t.Fatalf("unexpected top-level instruction: %+v", ixs[0])
+	}
+	if !ixs[1].IsInner() || ixs[1].InstructionIndex != 1 || !ixs[1].Accounts[0].Equals(readonly) {
+		t.Fatalf("unexpected inner instruction: %+v", ixs[1])
+	}
+	if Event(ixs[1].DataBytes[:8]) != mintVoucher {
+		t.Fatalf("unexpected discriminator: %x", ixs[1].DataBytes[:8])
+	}
+}
+
+func TestParsedInstructions(t *testing.T) {
+	owner := solana.NewWallet().PublicKey()
+	receiver := solana.NewWallet().PublicKey()
+	raw := `{"slot":10,"transaction":{"signatures":["` + solana.Signature{1}.String() + `"],"message":{` +
+		`"accountKeys":[{"pubkey":"` + owner.String() + `","signer":true,"writable":true},` +
+		`{"pubkey":"` + receiver.String() + `","signer":false,"writable":true},` +
+		`{"pubkey":"11111111111111111111111111111111","signer":false,"writable":false}],` +
+		`"instructions":[{"program":"system","programId":"11111111111111111111111111111111","stackHeight":null,` +
+		`"parsed":{"info":{"destination":"` + receiver.String() + `","lamports":1000,"source":"` + owner.String() + `"},"type":"transfer"}}],` +
+		`"recentBlockhash":"` + solana.Hash{2}.String() + `"}},"meta":{"err":null,"fee":5000,"innerInstructions":[],"logMessages":[]}}`
+
+	var parsed rpc.GetParsedTransactionResult
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	txInfo := TxInfo{TxSig: solana.Signature{1}, TxDetail: toTransactionResult(&parsed), ParsedTxDetail: &parsed}
+
+	ixs, err := txInfo.Instructions(nil, solana.SystemProgramID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ixs) != 1 || ixs[0].TxDetail.Slot != 10 {
+		t.Fatalf("unexpected instructions: %+v", ixs)
+	}
+	info, err := ixs[0].ParsedInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.InstructionType != "transfer" || info.Info["destination"] != receiver.String() {
+		t.Fatalf("unexpected parsed info: %+v", info)
+	}
+
+	msg, err := txInfo.ParsedMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.AccountKeys) != 3 || !msg.AccountKeys[0].Signer {
+		t.Fatalf("unexpected parsed message: %+v", msg)
+	}
+}
@@ -10,7 +10,27 @@ type IContract interface {
 	Close() error
 	DoneSignal() <-chan struct{}
 	RegisterEventHook(event Event, f func(client *rpcclient.SolClient, txInfo TxInfo) error) error
+	RegisterEventHookContext(event Event, f HookFunc) error
+	AddEventHook(event Event, f HookFunc) (Unregister, error)
+	AddUnhandledEventHook(f HookFunc) (Unregister, error)
 	HandleEvent(client *rpcclient.SolClient, event Event, txInfo TxInfo) error
+	RegisterInstructionHook(instruction Event, f func(client *rpcclient.SolClient, ixInfo InstructionInfo) error) error
+	RegisterInstructionHookContext(instruction Event, f InstructionHookFunc) error
+	AddInstructionHook(instruction Event, f InstructionHookFunc) (Unregister, error)
+	AddUnhandledInstructionHook(f InstructionHookFunc) (Unregister, error)
+	HandleInstruction(client *rpcclient.SolClient, instruction Event, ixInfo InstructionInfo) error
+	RegisterTxHook(f func(client *rpcclient.SolClient, txInfo TxInfo) error) error
+	RegisterTxHookContext(f HookFunc) error
+	AddTxHook(f HookFunc) (Unregister, error)
+	HandleTx(client *rpcclient.SolClient, txInfo TxInfo) error
+	RegisterFailedTxHook(f func(client *rpcclient.SolClient, txInfo TxInfo) error) error
+	RegisterFailedTxHookContext(f HookFunc) error
+	AddFailedTxHook(f HookFunc) (Unregister, error)
+	HandleFailedTx(client *rpcclient.SolClient, txInfo TxInfo) error
+	RegisterRollbackHook(f func(client *rpcclient.SolClient, txInfo TxInfo) error) error
+	RegisterRollbackHookContext(f HookFunc) error
+	AddRollbackHook(f HookFunc) (Unregister, error)
+	HandleRollback(client *rpcclient.SolClient, txInfo TxInfo) error
 	UpdateProcessedTxSignature(txSig solana.Signature) error
 	GetProcessedBlockNumber() solana.Signature
 	Scan(client *rpcclient.SolClient) error
@@ -0,0 +1,122 @@
+package sol
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/AcSunday/gwatch-chain/tracing"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// maxSignatureStatuses getSignatureStatuses accepts up to 256 signatures
+const maxSignatureStatuses = 256
+
+// pendingTx handled transaction that is not finalized yet
+type pendingTx struct {
+	TxSig solana.Signature
+	Slot  uint64
+}
+
+func (c *Contract) handleFailedTx(ctx context.Context, client *rpcclient.SolClient, txSig solana.Signature) error {
+	c.mu.RLock()
+	hasHook := c.txFunc.has(failedTxHook)
+	c.mu.RUnlock()
+	if !hasHook {
+		return nil
+	}
+
+	txInfo, err := c.getTransaction(ctx, client, txSig)
+	if err != nil {
+		return err
+	}
+	return c.callFailedTx(ctx, client, txInfo)
+}
+
+func (c *Contract) addPendingTxs(txs []pendingTx) {
+	if len(txs) == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.pendingTxs = append(c.pendingTxs, txs...)
+	c.mu.Unlock()
+}
+
+// checkPendingTxs the handled confirmed transactions are checked until finalized,
+// a transaction that disappeared is passed to the rollback Hook, and ProcessedTxSignature
+// moves back to the latest transaction that still exists
+func (c *Contract) checkPendingTxs(ctx context.Context, client *rpcclient.SolClient) error {
+	c.mu.RLock()
+	pending := c.pendingTxs
+	c.mu.RUnlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	rpcCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	statuses := make([]*rpc.SignatureStatusesResult, 0, len(pending))
+	for i := 0; i < len(pending); i += maxSignatureStatuses {
+		end := min(i+maxSignatureStatuses, len(pending))
+		sigs := make([]solana.Signature, 0, end-i)
+		for _, tx := range pending[i:end] {
+			sigs = append(sigs, tx.TxSig)
+		}
+
+		spanCtx, span := tracing.StartRPC(rpcCtx, c.tracer, client.GetRawUrl(), "getSignatureStatuses")
+		res, err := client.GetSignatureStatuses(spanCtx, true, sigs...)
+		tracing.End(span, err)
+		if err != nil {
+			return fmt.Errorf("get signature statuses failed, %v", err)
+		}
+		if len(res.Value) != len(sigs) {
+			return fmt.Errorf("get signature statuses failed, expected %d statuses, got %d", len(sigs), len(res.Value))
+		}
+		statuses = append(statuses, res.Value...)
+	}
+
+	var (
+		finalized solana.Signature
+		latest    solana.Signature // newest transaction that still exists
+		slot      uint64
+	)
+	remain := make([]pendingTx, 0, len(pending))
+	rolledBack := make(map[solana.Signature]struct{})
+	for i, status := range statuses {
+		tx := pending[i]
+		if status != nil && (latest.IsZero() || tx.Slot >= slot) {
+			latest, slot = tx.TxSig, tx.Slot
+		}
+		switch {
+		case status == nil:
+			c.logger().Info("confirmed transaction rolled back", "tx_sig", tx.TxSig, "slot", tx.Slot)
+			err := c.callRollback(ctx, client, TxInfo{ProgramId: c.ProgramId, TxSig: tx.TxSig})
+			if err != nil {
+				return err
+			}
+			rolledBack[tx.TxSig] = struct{}{}
+		case status.ConfirmationStatus == rpc.ConfirmationStatusFinalized:
+			finalized = tx.TxSig
+		default:
+			remain = append(remain, tx)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// pendingTxs only grows in Scan, the checked ones are the prefix
+	c.pendingTxs = append(remain, c.pendingTxs[len(pending):]...)
+	if !finalized.IsZero() {
+		c.finalizedTxSig = finalized
+	}
+	if _, ok := rolledBack[c.ProcessedTxSignature]; ok {
+		c.ProcessedTxSignature = c.finalizedTxSig
+		if !latest.IsZero() {
+			c.ProcessedTxSignature = latest
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package sol
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/metrics"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+func TestCheckPendingTxs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"context":{"slot":100},"value":[`+
+			`{"slot":10,"confirmations":null,"err":null,"confirmationStatus":"finalized"},`+
+			`{"slot":11,"confirmations":3,"err":null,"confirmationStatus":"confirmed"},`+
+			`null]}}`)
+	}))
+	defer server.Close()
+
+	client, err := rpcclient.NewSolClient(server.URL, 1177777711)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	finalized, confirmed, disappeared := solana.Signature{1}, solana.Signature{2}, solana.Signature{3}
+	contract, err := New(solana.NewWallet().PublicKey().String(), &Attrs{
+		ProcessedTxSignature: disappeared,
+		Commitment:           rpc.CommitmentConfirmed,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer contract.Close()
+
+	var rolledBack []solana.Signature
+	contract.RegisterRollbackHook(func(client *rpcclient.SolClient, txInfo TxInfo) error {
+		rolledBack = append(rolledBack, txInfo.TxSig)
+		return nil
+	})
+	contract.addPendingTxs([]pendingTx{{TxSig: finalized, Slot: 10}, {TxSig: confirmed, Slot: 11}, {TxSig: disappeared, Slot: 12}})
+
+	if err = contract.checkPendingTxs(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+	if len(rolledBack) != 1 || rolledBack[0] != disappeared {
+		t.Fatalf("unexpected rolled back txs: %v", rolledBack)
+	}
+	if len(contract.pendingTxs) != 1 || contract.pendingTxs[0].TxSig != confirmed {
+		t.Fatalf("unexpected pending txs: %v", contract.pendingTxs)
+	}
+	if contract.GetProcessedTxSignature() != confirmed || contract.finalizedTxSig != finalized {
+		t.Fatalf("unexpected processed tx signature: %v", contract.GetProcessedTxSignature())
+	}
+}
+
+func TestCheckPendingTxsFinalizedNewer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"context":{"slot":100},"value":[`+
+			`{"slot":10,"confirmations":3,"err":null,"confirmationStatus":"confirmed"},`+
+			`{"slot":11,"confirmations":null,"err":null,"confirmationStatus":"finalized"},`+
+			`null]}}`)
+	}))
+	defer server.Close()
+
+	client, err := rpcclient.NewSolClient(server.URL, 1177777711)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	confirmed, finalized, disappeared := solana.Signature{1}, solana.Signature{2}, solana.Signature{3}
+	contract, err := New(solana.NewWallet().PublicKey().String(), &Attrs{
+		ProcessedTxSignature: disappeared,
+		Commitment:           rpc.CommitmentConfirmed,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer contract.Close()
+	contract.addPendingTxs([]pendingTx{{TxSig: confirmed, Slot: 10}, {TxSig: finalized, Slot: 11}, {TxSig: disappeared, Slot: 12}})
+
+	if err = contract.checkPendingTxs(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+	// the finalized transaction is newer than the remaining one, it must not be delivered again
+	if contract.GetProcessedTxSignature() != finalized {
+		t.Fatalf("unexpected processed tx signature: %v", contract.GetProcessedTxSignature())
+	}
+}
+
+func TestRollbackHookContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.Method {
+		case "getSignatureStatuses":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"context":{"slot":100},"value":[null]}}`)
+		default:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":[]}`)
+		}
+	}))
+	defer server.Close()
+
+	client, err := rpcclient.NewSolClient(server.URL, 1177777711)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	disappeared := solana.Signature{3}
+	contract, err := New(solana.NewWallet().PublicKey().String(), &Attrs{
+		ChainId:              1177777711,
+		ProcessedTxSignature: disappeared,
+		Commitment:           rpc.CommitmentConfirmed,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hookCtx context.Context
+	contract.RegisterRollbackHookContext(func(ctx context.Context, client *rpcclient.SolClient, txInfo TxInfo) error {
+		hookCtx = ctx
+		return nil
+	})
+	contract.addPendingTxs([]pendingTx{{TxSig: disappeared, Slot: 12}})
+
+	if err = contract.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if hookCtx == nil {
+		t.Fatal("rollback hook is not called")
+	}
+	info, ok := ScanInfoFromContext(hookCtx)
+	if !ok || info.Node != metrics.NodeLabel(server.URL) || info.Until != disappeared || info.ChainId != 1177777711 {
+		t.Fatalf("unexpected scan info: %+v", info)
+	}
+	if hookCtx.Err() != nil {
+		t.Fatal("hook context is cancelled before Close")
+	}
+	contract.Close()
+	if hookCtx.Err() == nil {
+		t.Fatal("hook context is not cancelled after Close")
+	}
+}
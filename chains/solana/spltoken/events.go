@@ -0,0 +1,278 @@
+package spltoken
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	sol "github.com/AcSunday/gwatch-chain/chains/solana"
+	"github.com/AcSunday/gwatch-chain/utils"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/shopspring/decimal"
+)
+
+// string event
+const (
+	TransferEvent      sol.Event = "Transfer"      // Transfer, TransferChecked
+	MintEvent          sol.Event = "MintTo"        // MintTo, MintToChecked
+	BurnEvent          sol.Event = "Burn"          // Burn, BurnChecked
+	BalanceChangeEvent sol.Event = "BalanceChange" // diff of preTokenBalances and postTokenBalances
+)
+
+// instruction tags, same for the SPL Token and Token-2022 programs
+const (
+	transferTag        = 3
+	mintToTag          = 7
+	burnTag            = 8
+	transferCheckedTag = 12
+	mintToCheckedTag   = 14
+	burnCheckedTag     = 15
+)
+
+// TokenPrograms SPL Token and Token-2022
+var TokenPrograms = []solana.PublicKey{solana.TokenProgramID, solana.Token2022ProgramID}
+
+type TokenEvent struct {
+	Event            sol.Event
+	TokenProgram     solana.PublicKey // SPL Token or Token-2022, zero for BalanceChangeEvent
+	Mint             solana.PublicKey
+	Source           solana.PublicKey // source token account, zero for MintEvent
+	Destination      solana.PublicKey // destination token account, zero for BurnEvent
+	SourceOwner      solana.PublicKey // owner of Source, zero if unknown
+	DestinationOwner solana.PublicKey // owner of Destination, zero if unknown
+	Authority        solana.PublicKey // signer of the instruction
+	Amount           *big.Int         // raw amount, the signed delta for BalanceChangeEvent
+	Decimals         uint8
+	Symbol           string
+	decimalsKnown    bool // Decimals is decoded or filled, 0 is a valid decimals
+
+	TxSig            solana.Signature
+	TxDetail         *rpc.GetTransactionResult
+	InstructionIndex uint16 // index of the top-level instruction
+	InnerIndex       int    // sol.TopLevelInstruction if not inner
+}
+
+// UiAmount amount accounting for decimals
+func (e TokenEvent) UiAmount() decimal.Decimal {
+	return utils.BigIntToDecimal(e.Amount, int32(e.Decimals))
+}
+
+// decodeInstruction Transfer/TransferChecked/MintTo/MintToChecked/Burn/BurnChecked of token programs
+//
+//	Transfer:        [source, destination, authority]
+//	TransferChecked: [source, mint, destination, authority]
+//	MintTo(Checked): [mint, destination, authority]
+//	Burn(Checked):   [account, mint, authority]
+//
+// the jsonParsed instructions are decoded from the parsed info, an error is returned if the info is malformed
+func decodeInstruction(ix sol.InstructionInfo) (TokenEvent, bool, error) {
+	if ix.Parsed != nil && ix.Parsed.Parsed != nil {
+		return decodeParsedInstruction(ix)
+	}
+
+	data, accounts := ix.DataBytes, ix.Accounts
+	if len(data) < 9 || len(accounts) < 3 {
+		return TokenEvent{}, false, nil
+	}
+
+	e := TokenEvent{
+		TokenProgram:     ix.ProgramId,
+		Amount:           new(big.Int).SetUint64(binary.LittleEndian.Uint64(data[1:9])),
+		TxSig:            ix.TxSig,
+		TxDetail:         ix.TxDetail,
+		InstructionIndex: ix.InstructionIndex,
+		InnerIndex:       ix.InnerIndex,
+	}
+	switch data[0] {
+	case transferTag:
+		e.Event = TransferEvent
+		e.Source, e.Destination, e.Authority = accounts[0], accounts[1], accounts[2]
+	case transferCheckedTag:
+		if len(data) < 10 || len(accounts) < 4 {
+			return TokenEvent{}, false, nil
+		}
+		e.Event = TransferEvent
+		e.Source, e.Mint, e.Destination, e.Authority = accounts[0], accounts[1], accounts[2], accounts[3]
+		e.Decimals, e.decimalsKnown = data[9], true
+	case mintToTag, mintToCheckedTag:
+		e.Event = MintEvent
+		e.Mint, e.Destination, e.Authority = accounts[0], accounts[1], accounts[2]
+		if data[0] == mintToCheckedTag && len(data) >= 10 {
+			e.Decimals, e.decimalsKnown = data[9], true
+		}
+	case burnTag, burnCheckedTag:
+		e.Event = BurnEvent
+		e.Source, e.Mint, e.Authority = accounts[0], accounts[1], accounts[2]
+		if data[0] == burnCheckedTag && len(data) >= 10 {
+			e.Decimals, e.decimalsKnown = data[9], true
+		}
+	default:
+		return TokenEvent{}, false, nil
+	}
+	return e, true, nil
+}
+
+// decodeParsedInstruction the info of the parsed types transfer, transferChecked, mintTo, mintToChecked,
+// burn and burnChecked, the multisig authority is the Authority
+func decodeParsedInstruction(ix sol.InstructionInfo) (TokenEvent, bool, error) {
+	info, err := ix.ParsedInfo()
+	if err != nil {
+		return TokenEvent{}, false, fmt.Errorf("decode parsed instruction failed, %v", err)
+	}
+	if info == nil {
+		return TokenEvent{}, false, nil
+	}
+
+	e := TokenEvent{
+		TokenProgram:     ix.ProgramId,
+		TxSig:            ix.TxSig,
+		TxDetail:         ix.TxDetail,
+		InstructionIndex: ix.InstructionIndex,
+		InnerIndex:       ix.InnerIndex,
+	}
+	p := parsedInfo{info: info.Info}
+	switch info.InstructionType {
+	case "transfer":
+		e.Event = TransferEvent
+		e.Source, e.Destination, e.Authority = p.key("source"), p.key("destination"), p.key("authority", "multisigAuthority")
+		e.Amount = p.amount()
+	case "transferChecked":
+		e.Event = TransferEvent
+		e.Source, e.Mint, e.Destination = p.key("source"), p.key("mint"), p.key("destination")
+		e.Authority = p.key("authority", "multisigAuthority")
+		e.Amount, e.Decimals = p.tokenAmount()
+		e.decimalsKnown = true
+	case "mintTo", "mintToChecked":
+		e.Event = MintEvent
+		e.Mint, e.Destination, e.Authority = p.key("mint"), p.key("account"), p.key("mintAuthority", "multisigMintAuthority")
+		if info.InstructionType == "mintToChecked" {
+			e.Amount, e.Decimals = p.tokenAmount()
+			e.decimalsKnown = true
+		} else {
+			e.Amount = p.amount()
+		}
+	case "burn", "burnChecked":
+		e.Event = BurnEvent
+		e.Source, e.Mint, e.Authority = p.key("account"), p.key("mint"), p.key("authority", "multisigAuthority")
+		if info.InstructionType == "burnChecked" {
+			e.Amount, e.Decimals = p.tokenAmount()
+			e.decimalsKnown = true
+		} else {
+			e.Amount = p.amount()
+		}
+	default:
+		return TokenEvent{}, false, nil
+	}
+	if p.err != nil {
+		return TokenEvent{}, false, fmt.Errorf("decode parsed %s instruction failed, %v", info.InstructionType, p.err)
+	}
+	return e, true, nil
+}
+
+// parsedInfo reads the fields of the parsed info, the first error is kept
+type parsedInfo struct {
+	info map[string]any
+	err  error
+}
+
+func (p *parsedInfo) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// key the first present field of names
+func (p *parsedInfo) key(names ...string) solana.PublicKey {
+	for _, name := range names {
+		v, ok := p.info[name].(string)
+		if !ok {
+			continue
+		}
+		key, err := solana.PublicKeyFromBase58(v)
+		if err != nil {
+			p.fail(fmt.Errorf("invalid %s %q, %v", name, v, err))
+		}
+		return key
+	}
+	p.fail(fmt.Errorf("%s not found", names[0]))
+	return solana.PublicKey{}
+}
+
+// amount the raw amount is a decimal string
+func (p *parsedInfo) amount() *big.Int {
+	v, _ := p.info["amount"].(string)
+	amount, ok := new(big.Int).SetString(v, 10)
+	if !ok {
+		p.fail(fmt.Errorf("invalid amount %q", v))
+		return new(big.Int)
+	}
+	return amount
+}
+
+// tokenAmount the amount and the decimals of the checked instructions
+func (p *parsedInfo) tokenAmount() (*big.Int, uint8) {
+	tokenAmount, ok := p.info["tokenAmount"].(map[string]any)
+	if !ok {
+		p.fail(errors.New("tokenAmount not found"))
+		return new(big.Int), 0
+	}
+	decimals, _ := tokenAmount["decimals"].(float64)
+	sub := &parsedInfo{info: tokenAmount}
+	amount := sub.amount()
+	p.fail(sub.err)
+	return amount, uint8(decimals)
+}
+
+type tokenBalance struct {
+	accountIndex uint16
+	mint         solana.PublicKey
+	owner        solana.PublicKey
+	decimals     uint8
+	pre          *big.Int
+	post         *big.Int
+}
+
+// tokenBalances key is token account
+func tokenBalances(accountKeys solana.PublicKeySlice, meta *rpc.TransactionMeta) map[solana.PublicKey]*tokenBalance {
+	res := make(map[solana.PublicKey]*tokenBalance, len(meta.PostTokenBalances))
+	set := func(b rpc.TokenBalance, isPost bool) {
+		if int(b.AccountIndex) >= len(accountKeys) || b.UiTokenAmount == nil {
+			return
+		}
+		amount, ok := new(big.Int).SetString(b.UiTokenAmount.Amount, 10)
+		if !ok {
+			return
+		}
+
+		account := accountKeys[b.AccountIndex]
+		tb, ok := res[account]
+		if !ok {
+			tb = &tokenBalance{
+				accountIndex: b.AccountIndex,
+				mint:         b.Mint,
+				decimals:     b.UiTokenAmount.Decimals,
+				pre:          new(big.Int),
+				post:         new(big.Int),
+			}
+			res[account] = tb
+		}
+		if b.Owner != nil {
+			tb.owner = *b.Owner
+		}
+		if isPost {
+			tb.post = amount
+		} else {
+			tb.pre = amount
+		}
+	}
+
+	for _, b := range meta.PreTokenBalances {
+		set(b, false)
+	}
+	for _, b := range meta.PostTokenBalances {
+		set(b, true)
+	}
+	return res
+}
@@ -0,0 +1,354 @@
+package spltoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"sync"
+
+	sol "github.com/AcSunday/gwatch-chain/chains/solana"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/gagliardetto/solana-go"
+)
+
+// maxSeenTxs a transaction touching several watched token accounts is handled once
+const maxSeenTxs = 4096
+
+// Token watch SPL Token and Token-2022 transfers of a mint or a set of token accounts
+//
+//	mint: all transactions that reference the mint account, a plain Transfer instruction
+//	  does not reference the mint, watch the token accounts to receive it
+//	token accounts: all transactions of the token accounts, each account has its own processed tx signature
+type Token struct {
+	Mint     solana.PublicKey              // zero when watching token accounts
+	Accounts map[solana.PublicKey]struct{} // watched token accounts, empty when watching mint
+
+	contracts      []*sol.Contract // one per watched address
+	contractToDesc map[string]sol.ContractDesc
+	handleFunc     map[sol.Event][]hookEntry // key is event, in order of registration
+	hookSeq        uint64
+	mu             sync.RWMutex
+
+	seen, prevSeen map[solana.Signature]struct{}
+}
+
+// New watch the token transfers of mint,
+// attrs.ProcessedTxSignature is the earliest transaction signature of the mint to start,
+// attrs.ContractToDesc key is mint
+func New(mint string, attrs *sol.Attrs) (*Token, error) {
+	c, err := sol.New(mint, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	t := newToken(attrs)
+	t.Mint = c.ProgramId
+	if err = t.addContract(c); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// NewTokenAccounts watch the token transfers of token accounts,
+// key is token account, value is the earliest transaction signature of the account to start,
+// attrs.ContractToDesc key is mint
+func NewTokenAccounts(accounts map[string]solana.Signature, attrs *sol.Attrs) (*Token, error) {
+	if len(accounts) == 0 {
+		return nil, errors.New("token accounts is empty")
+	}
+
+	t := newToken(attrs)
+	for account, processedTxSig := range accounts {
+		a := *attrs
+		a.ProcessedTxSignature = processedTxSig
+		c, err := sol.New(account, &a)
+		if err != nil {
+			return nil, fmt.Errorf("token account %s, %v", account, err)
+		}
+
+		t.Accounts[c.ProgramId] = struct{}{}
+		if err = t.addContract(c); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func newToken(attrs *sol.Attrs) *Token {
+	return &Token{
+		Accounts:       make(map[solana.PublicKey]struct{}),
+		contractToDesc: attrs.ContractToDesc,
+		handleFunc:     make(map[sol.Event][]hookEntry, 4),
+		seen:           make(map[solana.Signature]struct{}),
+		prevSeen:       make(map[solana.Signature]struct{}),
+	}
+}
+
+func (t *Token) addContract(c *sol.Contract) error {
+	err := c.RegisterTxHookContext(t.handleTx)
+	if err != nil {
+		return err
+	}
+	t.contracts = append(t.contracts, c)
+	return nil
+}
+
+func (t *Token) Scan(client *rpcclient.SolClient) error {
+	for _, c := range t.contracts {
+		err := c.Scan(client)
+		if err != nil {
+			return fmt.Errorf("scan %s failed, %v", c.ProgramId, err)
+		}
+	}
+	return nil
+}
+
+func (t *Token) Close() error {
+	for _, c := range t.contracts {
+		c.Close()
+	}
+	return nil
+}
+
+func (t *Token) DoneSignal() <-chan struct{} {
+	return t.contracts[0].DoneSignal()
+}
+
+// HookFunc context-aware Hook of token event, see sol.HookFunc
+type HookFunc func(ctx context.Context, client *rpcclient.SolClient, event TokenEvent) error
+
+type hookEntry struct {
+	id uint64
+	f  HookFunc
+}
+
+// RegisterEventHook Hook is a function that handles token event, the hooks of an event are called in order of registration,
+// HandleEvent method call this Hook
+func (t *Token) RegisterEventHook(event sol.Event, f func(client *rpcclient.SolClient, event TokenEvent) error) error {
+	return t.RegisterEventHookContext(event, func(ctx context.Context, client *rpcclient.SolClient, event TokenEvent) error {
+		return f(client, event)
+	})
+}
+
+// RegisterEventHookContext Hook receives the context of the scan, see sol.HookFunc,
+// HandleEvent method call this Hook
+func (t *Token) RegisterEventHookContext(event sol.Event, f HookFunc) error {
+	_, err := t.AddEventHook(event, f)
+	return err
+}
+
+// AddEventHook appends the Hook of event and returns the handle to remove it
+func (t *Token) AddEventHook(event sol.Event, f HookFunc) (sol.Unregister, error) {
+	if t.contracts[0].IsClose.Load() {
+		return nil, errors.New("already closed, Registration of event hook is prohibited")
+	}
+	t.mu.Lock()
+	t.hookSeq++
+	id := t.hookSeq
+	t.handleFunc[event] = append(t.handleFunc[event], hookEntry{id: id, f: f})
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			entries := t.handleFunc[event]
+			for i, e := range entries {
+				if e.id == id {
+					t.handleFunc[event] = append(entries[:i:i], entries[i+1:]...)
+					break
+				}
+			}
+			if len(t.handleFunc[event]) == 0 {
+				delete(t.handleFunc, event)
+			}
+		})
+	}, nil
+}
+
+// HandleEvent method call Hook, ctx of the Hook is cancelled when the token is closed
+func (t *Token) HandleEvent(client *rpcclient.SolClient, event TokenEvent) error {
+	return t.HandleEventContext(t.contracts[0].Context(), client, event)
+}
+
+// HandleEventContext method call Hook with ctx
+func (t *Token) HandleEventContext(ctx context.Context, client *rpcclient.SolClient, event TokenEvent) error {
+	// hooks are called without the lock, they may register or unregister hooks
+	t.mu.RLock()
+	hooks := slices.Clone(t.handleFunc[event.Event])
+	t.mu.RUnlock()
+	for _, h := range hooks {
+		if err := h.f(ctx, client, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetProcessedTxSignatures key is the watched mint or token account
+func (t *Token) GetProcessedTxSignatures() map[string]solana.Signature {
+	res := make(map[string]solana.Signature, len(t.contracts))
+	for _, c := range t.contracts {
+		res[c.ProgramId.String()] = c.GetProcessedTxSignature()
+	}
+	return res
+}
+
+func (t *Token) GetContractDesc(mint string) (sol.ContractDesc, error) {
+	v, ok := t.contractToDesc[mint]
+	if !ok {
+		return sol.ContractDesc{}, errors.New("not found")
+	}
+	return v, nil
+}
+
+func (t *Token) handleTx(ctx context.Context, client *rpcclient.SolClient, txInfo sol.TxInfo) error {
+	tx := txInfo.TxDetail
+	// failed transaction does not change balances
+	if tx == nil || tx.Meta == nil || tx.Meta.Err != nil {
+		return nil
+	}
+	if t.isSeen(txInfo.TxSig) {
+		return nil
+	}
+
+	accountKeys, err := txInfo.AccountKeys(client)
+	if err != nil {
+		return fmt.Errorf("txSig: %v, %v", txInfo.TxSig, err)
+	}
+	balances := tokenBalances(accountKeys, tx.Meta)
+
+	ixs, err := txInfo.Instructions(client, TokenPrograms...)
+	if err != nil {
+		return fmt.Errorf("txSig: %v, %v", txInfo.TxSig, err)
+	}
+	for _, ix := range ixs {
+		e, ok, err := decodeInstruction(ix)
+		if err != nil {
+			return fmt.Errorf("txSig: %v, %v", txInfo.TxSig, err)
+		}
+		if !ok {
+			continue
+		}
+		e.TxSig = txInfo.TxSig
+		t.fillFromBalances(&e, balances)
+		if !t.isWatched(e) {
+			continue
+		}
+
+		err = t.HandleEventContext(ctx, client, e)
+		if err != nil {
+			return err
+		}
+	}
+
+	// balance changes ordered by account index
+	accounts := make([]solana.PublicKey, 0, len(balances))
+	for account, b := range balances {
+		if b.pre.Cmp(b.post) != 0 {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return balances[accounts[i]].accountIndex < balances[accounts[j]].accountIndex
+	})
+	for _, account := range accounts {
+		b := balances[account]
+		e := TokenEvent{
+			Event:            BalanceChangeEvent,
+			Mint:             b.mint,
+			Destination:      account,
+			DestinationOwner: b.owner,
+			Amount:           new(big.Int).Sub(b.post, b.pre),
+			Decimals:         b.decimals,
+			decimalsKnown:    true,
+			TxSig:            txInfo.TxSig,
+			TxDetail:         tx,
+			InnerIndex:       sol.TopLevelInstruction,
+		}
+		t.fillDesc(&e)
+		if !t.isWatched(e) {
+			continue
+		}
+
+		err = t.HandleEventContext(ctx, client, e)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.markSeen(txInfo.TxSig)
+	return nil
+}
+
+// fillFromBalances mint, owners and decimals of the token accounts
+func (t *Token) fillFromBalances(e *TokenEvent, balances map[solana.PublicKey]*tokenBalance) {
+	for _, account := range []solana.PublicKey{e.Source, e.Destination} {
+		b, ok := balances[account]
+		if !ok {
+			continue
+		}
+		if e.Mint.IsZero() {
+			e.Mint = b.mint
+		}
+		if !e.decimalsKnown {
+			e.Decimals, e.decimalsKnown = b.decimals, true
+		}
+		if account == e.Source {
+			e.SourceOwner = b.owner
+		} else {
+			e.DestinationOwner = b.owner
+		}
+	}
+	t.fillDesc(e)
+}
+
+func (t *Token) fillDesc(e *TokenEvent) {
+	desc, err := t.GetContractDesc(e.Mint.String())
+	if err != nil {
+		return
+	}
+	e.Symbol = desc.Symbol
+	if !e.decimalsKnown {
+		e.Decimals, e.decimalsKnown = desc.Decimals, true
+	}
+}
+
+func (t *Token) isWatched(e TokenEvent) bool {
+	if !t.Mint.IsZero() {
+		return e.Mint.Equals(t.Mint)
+	}
+
+	_, src := t.Accounts[e.Source]
+	_, dst := t.Accounts[e.Destination]
+	return src || dst
+}
+
+// isSeen the transaction has been handled by another watched token account
+func (t *Token) isSeen(txSig solana.Signature) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	_, ok := t.seen[txSig]
+	if !ok {
+		_, ok = t.prevSeen[txSig]
+	}
+	return ok
+}
+
+func (t *Token) markSeen(txSig solana.Signature) {
+	if len(t.contracts) < 2 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.seen) >= maxSeenTxs {
+		t.prevSeen, t.seen = t.seen, make(map[solana.Signature]struct{}, maxSeenTxs)
+	}
+	t.seen[txSig] = struct{}{}
+}
@@ -0,0 +1,252 @@
+package spltoken
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sol "github.com/AcSunday/gwatch-chain/chains/solana"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+func TestHandleTransfer(t *testing.T) {
+	authority := solana.NewWallet().PublicKey()
+	src := solana.NewWallet().PublicKey()
+	dst := solana.NewWallet().PublicKey()
+	receiver := solana.NewWallet().PublicKey()
+	mint := solana.NewWallet().PublicKey()
+
+	data := make([]byte, 9)
+	data[0] = transferTag
+	binary.LittleEndian.PutUint64(data[1:], 2500000)
+	rawTx := &solana.Transaction{
+		Signatures: []solana.Signature{{1}},
+		Message: solana.Message{
+			Header:      solana.MessageHeader{NumRequiredSignatures: 1, NumReadonlyUnsignedAccounts: 1},
+			AccountKeys: solana.PublicKeySlice{authority, src, dst, solana.TokenProgramID},
+			Instructions: []solana.CompiledInstruction{
+				{ProgramIDIndex: 3, Accounts: []uint16{1, 2, 0}, Data: data},
+			},
+		},
+	}
+	txBytes, err := rawTx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	balance := func(idx int, owner solana.PublicKey, amount string) string {
+		return fmt.Sprintf(`{"accountIndex":%d,"mint":"%s","owner":"%s","uiTokenAmount":{"amount":"%s","decimals":6}}`,
+			idx, mint, owner, amount)
+	}
+	raw := fmt.Sprintf(`{"slot":10,"transaction":["%s","base64"],"meta":{"err":null,"preTokenBalances":[%s,%s],"postTokenBalances":[%s,%s]}}`,
+		base64.StdEncoding.EncodeToString(txBytes),
+		balance(1, authority, "5000000"), balance(2, receiver, "0"),
+		balance(1, authority, "2500000"), balance(2, receiver, "2500000"),
+	)
+	var txDetail rpc.GetTransactionResult
+	if err = json.Unmarshal([]byte(raw), &txDetail); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := NewTokenAccounts(map[string]solana.Signature{dst.String(): {1}}, &sol.Attrs{
+		ContractToDesc: map[string]sol.ContractDesc{
+			mint.String(): {Name: "USD Coin", Symbol: "USDC", Decimals: 6},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer token.Close()
+
+	events := make([]TokenEvent, 0, 2)
+	hook := func(client *rpcclient.SolClient, event TokenEvent) error {
+		events = append(events, event)
+		return nil
+	}
+	token.RegisterEventHook(TransferEvent, hook)
+	token.RegisterEventHook(BalanceChangeEvent, hook)
+
+	err = token.handleTx(context.Background(), nil, sol.TxInfo{TxSig: rawTx.Signatures[0], TxDetail: &txDetail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	transfer := events[0]
+	if transfer.Event != TransferEvent || !transfer.Mint.Equals(mint) || !transfer.DestinationOwner.Equals(receiver) ||
+		transfer.Symbol != "USDC" || transfer.UiAmount().String() != "2.5" {
+		t.Fatalf("unexpected transfer event: %+v", transfer)
+	}
+	change := events[1]
+	if change.Event != BalanceChangeEvent || !change.Destination.Equals(dst) || change.Amount.Int64() != 2500000 {
+		t.Fatalf("unexpected balance change event: %+v", change)
+	}
+}
+
+func TestHandleEventClosed(t *testing.T) {
+	token, err := New(solana.NewWallet().PublicKey().String(), &sol.Attrs{ProcessedTxSignature: solana.Signature{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hookCtx context.Context
+	token.RegisterEventHookContext(TransferEvent, func(ctx context.Context, client *rpcclient.SolClient, event TokenEvent) error {
+		hookCtx = ctx
+		return nil
+	})
+	if err = token.HandleEvent(nil, TokenEvent{Event: TransferEvent}); err != nil {
+		t.Fatal(err)
+	}
+	if hookCtx.Err() != nil {
+		t.Fatal("hook ctx is cancelled before close")
+	}
+	token.Close()
+	if hookCtx.Err() == nil {
+		t.Fatal("hook ctx is not cancelled on close")
+	}
+}
+
+func TestEventHooks(t *testing.T) {
+	token, err := New(solana.NewWallet().PublicKey().String(), &sol.Attrs{ProcessedTxSignature: solana.Signature{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer token.Close()
+	var calls []string
+	token.RegisterEventHook(TransferEvent, func(client *rpcclient.SolClient, event TokenEvent) error {
+		calls = append(calls, "first")
+		return nil
+	})
+	unregister, err := token.AddEventHook(TransferEvent, func(ctx context.Context, client *rpcclient.SolClient, event TokenEvent) error {
+		calls = append(calls, "second")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token.HandleEvent(nil, TokenEvent{Event: TransferEvent})
+	unregister()
+	unregister()
+	token.HandleEvent(nil, TokenEvent{Event: TransferEvent})
+	if fmt.Sprint(calls) != "[first second first]" {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+func TestFillDecimals(t *testing.T) {
+	mint := solana.NewWallet().PublicKey()
+	token, err := New(mint.String(), &sol.Attrs{ProcessedTxSignature: solana.Signature{1},
+		ContractToDesc: map[string]sol.ContractDesc{mint.String(): {Symbol: "USDC", Decimals: 6}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer token.Close()
+
+	// the decimals of a 0-decimal mint decoded from TransferChecked are kept
+	checked := TokenEvent{Mint: mint, decimalsKnown: true}
+	token.fillFromBalances(&checked, nil)
+	unknown := TokenEvent{Mint: mint}
+	token.fillFromBalances(&unknown, nil)
+	if checked.Decimals != 0 || checked.Symbol != "USDC" || unknown.Decimals != 6 {
+		t.Fatalf("unexpected decimals: checked %d, unknown %d", checked.Decimals, unknown.Decimals)
+	}
+}
+
+func TestScanJSONParsed(t *testing.T) {
+	authority := solana.NewWallet().PublicKey()
+	src := solana.NewWallet().PublicKey()
+	dst := solana.NewWallet().PublicKey()
+	receiver := solana.NewWallet().PublicKey()
+	mint := solana.NewWallet().PublicKey()
+	txSig := solana.Signature{5}
+
+	key := func(k solana.PublicKey, signer, writable bool) string {
+		return fmt.Sprintf(`{"pubkey":"%s","signer":%t,"writable":%t}`, k, signer, writable)
+	}
+	balance := func(idx int, owner solana.PublicKey, amount string) string {
+		return fmt.Sprintf(`{"accountIndex":%d,"mint":"%s","owner":"%s","uiTokenAmount":{"amount":"%s","decimals":6}}`,
+			idx, mint, owner, amount)
+	}
+	tx := fmt.Sprintf(`{"slot":10,"transaction":{"signatures":["%s"],"message":{"accountKeys":[%s,%s,%s,%s,%s],`+
+		`"instructions":[{"program":"spl-token","programId":"%s","stackHeight":null,"parsed":{"type":"transferChecked","info":`+
+		`{"source":"%s","mint":"%s","destination":"%s","authority":"%s","tokenAmount":{"amount":"2500000","decimals":6,"uiAmount":2.5,"uiAmountString":"2.5"}}}}],`+
+		`"recentBlockhash":"%s"}},"meta":{"err":null,"fee":5000,"logMessages":[],`+
+		`"innerInstructions":[{"index":0,"instructions":[{"program":"spl-token","programId":"%s","stackHeight":2,"parsed":{"type":"burn","info":`+
+		`{"account":"%s","mint":"%s","multisigAuthority":"%s","signers":["%s"],"amount":"100"}}}]}],`+
+		`"preTokenBalances":[%s,%s],"postTokenBalances":[%s,%s]}}`,
+		txSig, key(authority, true, true), key(src, false, true), key(dst, false, true), key(mint, false, true), key(solana.TokenProgramID, false, false),
+		solana.TokenProgramID, src, mint, dst, authority, solana.Hash{2},
+		solana.TokenProgramID, dst, mint, receiver, authority,
+		balance(1, authority, "5000000"), balance(2, receiver, "0"),
+		balance(1, authority, "2500000"), balance(2, receiver, "2499900"),
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.Method {
+		case "getSignaturesForAddress":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":[{"signature":"%s","slot":10,"err":null,"memo":null,"blockTime":null,"confirmationStatus":"finalized"}]}`, txSig)
+		case "getTransaction":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":%s}`, tx)
+		default:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":null}`)
+		}
+	}))
+	defer server.Close()
+
+	client, err := rpcclient.NewSolClient(server.URL, 1177777711)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	token, err := NewTokenAccounts(map[string]solana.Signature{dst.String(): {1}}, &sol.Attrs{
+		Encoding: solana.EncodingJSONParsed,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer token.Close()
+
+	var events []TokenEvent
+	hook := func(client *rpcclient.SolClient, event TokenEvent) error {
+		events = append(events, event)
+		return nil
+	}
+	for _, event := range []sol.Event{TransferEvent, BurnEvent, BalanceChangeEvent} {
+		token.RegisterEventHook(event, hook)
+	}
+
+	if err = token.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	transfer := events[0]
+	if transfer.Event != TransferEvent || !transfer.Source.Equals(src) || !transfer.Destination.Equals(dst) ||
+		!transfer.Authority.Equals(authority) || !transfer.DestinationOwner.Equals(receiver) ||
+		transfer.Decimals != 6 || transfer.UiAmount().String() != "2.5" || transfer.InnerIndex != sol.TopLevelInstruction {
+		t.Fatalf("unexpected transfer event: %+v", transfer)
+	}
+	burn := events[1]
+	if burn.Event != BurnEvent || !burn.Source.Equals(dst) || !burn.Authority.Equals(receiver) ||
+		burn.Amount.Int64() != 100 || burn.InnerIndex != 0 {
+		t.Fatalf("unexpected burn event: %+v", burn)
+	}
+	if change := events[2]; change.Event != BalanceChangeEvent || change.Amount.Int64() != 2499900 {
+		t.Fatalf("unexpected balance change event: %+v", change)
+	}
+}
@@ -5,85 +5,202 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"github.com/AcSunday/gwatch-chain/metrics"
 	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/AcSunday/gwatch-chain/tracing"
 	"github.com/AcSunday/gwatch-chain/utils"
 	"github.com/gagliardetto/solana-go"
 	"strings"
 	"time"
 
 	"github.com/gagliardetto/solana-go/rpc"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var NotFoundProgramDataErr = errors.New("program data not found")
 
+// maxSupportedTxVersion legacy and v0 transactions
+var maxSupportedTxVersion uint64 = 0
+
 func (c *Contract) Scan(client *rpcclient.SolClient) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, span := c.tracer.Start(c.ctx, tracing.ScanSpan, trace.WithAttributes(
+		tracing.ChainIdKey.Int64(int64(c.ChainId)),
+		tracing.ChainKey.String(c.Chain),
+		tracing.ProgramIdKey.String(c.ProgramId.String()),
+	))
+	err := c.scan(ctx, client)
+	tracing.End(span, err)
+	return err
+}
+
+// scan ctx carries the span of the scan cycle
+func (c *Contract) scan(ctx context.Context, client *rpcclient.SolClient) error {
+	info := ScanInfo{
+		ChainId:   c.ChainId,
+		Chain:     c.Chain,
+		ProgramId: c.ProgramId,
+		Until:     c.GetProcessedTxSignature(),
+		Node:      metrics.NodeLabel(client.GetRawUrl()),
+	}
+	ctx = WithScanInfo(ctx, info)
+
+	// confirmed transactions that have been rolled back
+	err := c.checkPendingTxs(ctx, client)
+	if err != nil {
+		return err
+	}
+	// moved back if the processed transaction has been rolled back
+	info.Until = c.GetProcessedTxSignature()
+
+	rpcCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var txSigs []*rpc.TransactionSignature
-	var err error
-
-	txSigs, err = client.GetSignaturesForAddressWithOpts(ctx, c.ProgramId, &rpc.GetSignaturesForAddressOpts{
+	rpcCtx, rpcSpan := tracing.StartRPC(rpcCtx, c.tracer, client.GetRawUrl(), "getSignaturesForAddress")
+	txSigs, err = client.GetSignaturesForAddressWithOpts(rpcCtx, c.ProgramId, &rpc.GetSignaturesForAddressOpts{
 		//Limit:      &c.WatchBlockLimit,
-		Until:      c.ProcessedTxSignature,
-		Commitment: rpc.CommitmentFinalized,
+		Until:      info.Until,
+		Commitment: c.Commitment,
 	})
+	tracing.End(rpcSpan, err)
 	if err != nil {
+		c.logger().Warn("get signatures failed", "node", metrics.NodeLabel(client.GetRawUrl()), "err", err)
 		return err
 	}
 
+	if len(txSigs) > 0 {
+		info.FromSlot, info.ToSlot = txSigs[len(txSigs)-1].Slot, txSigs[0].Slot
+		ctx = WithScanInfo(ctx, info)
+	}
+
 	// handle tx sig
+	pending := make([]pendingTx, 0)
 	for i := len(txSigs) - 1; i >= 0; i-- {
-		err = c.handleTx(client, txSigs[i].Signature)
+		txSig := txSigs[i]
+		if txSig.Err != nil {
+			err = c.handleFailedTx(ctx, client, txSig.Signature)
+		} else {
+			err = c.handleTx(ctx, client, txSig.Signature)
+		}
 		if err != nil {
+			c.logger().Warn("handle transaction failed, the transactions are scanned again",
+				"tx_sig", txSig.Signature, "slot", txSig.Slot, "err", err)
 			return err
 		}
+
+		if txSig.ConfirmationStatus != rpc.ConfirmationStatusFinalized && c.Commitment != rpc.CommitmentFinalized {
+			pending = append(pending, pendingTx{TxSig: txSig.Signature, Slot: txSig.Slot})
+		}
 	}
 
 	// update ProcessedTxSignature
+	trace.SpanFromContext(ctx).SetAttributes(tracing.LogsKey.Int(len(txSigs)))
 	if len(txSigs) == 0 {
 		return nil
 	}
+	c.addPendingTxs(pending)
+	c.logger().Debug("scanned transactions", "txs", len(txSigs), "pending_txs", len(pending),
+		"from_slot", txSigs[len(txSigs)-1].Slot, "to_slot", txSigs[0].Slot, "processed_tx_sig", txSigs[0].Signature)
 	return c.UpdateProcessedTxSignature(txSigs[0].Signature)
 }
 
-func (c *Contract) handleTx(client *rpcclient.SolClient, txSig solana.Signature) error {
-	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Second*5)
+// getTransaction the returned TxInfo has no event data
+func (c *Contract) getTransaction(ctx context.Context, client *rpcclient.SolClient, txSig solana.Signature) (TxInfo, error) {
+	ctx, cancelFunc := context.WithTimeout(ctx, time.Second*5)
 	defer cancelFunc()
 
+	txInfo := TxInfo{ProgramId: c.ProgramId, TxSig: txSig}
+	ctx, span := tracing.StartRPC(ctx, c.tracer, client.GetRawUrl(), "getTransaction")
+	span.SetAttributes(tracing.TxSigKey.String(txSig.String()))
+	if c.Encoding == solana.EncodingJSONParsed {
+		parsed, err := client.GetParsedTransaction(ctx, txSig, &rpc.GetParsedTransactionOpts{
+			Commitment:                     c.Commitment,
+			MaxSupportedTransactionVersion: &maxSupportedTxVersion,
+		})
+		tracing.End(span, err)
+		if err != nil {
+			return txInfo, fmt.Errorf("get parsed transaction %v failed, %v", txSig, err)
+		}
+		if parsed == nil || parsed.Meta == nil || parsed.Transaction == nil {
+			return txInfo, fmt.Errorf("txSig: %v, get parsed tx detail failed, tx or meta is nil", txSig)
+		}
+		txInfo.TxDetail = toTransactionResult(parsed)
+		txInfo.ParsedTxDetail = parsed
+		return txInfo, nil
+	}
+
 	tx, err := client.GetTransaction(ctx, txSig, &rpc.GetTransactionOpts{
-		Encoding:   solana.EncodingBase64,
-		Commitment: rpc.CommitmentFinalized,
+		Encoding:                       c.Encoding,
+		Commitment:                     c.Commitment,
+		MaxSupportedTransactionVersion: &maxSupportedTxVersion,
 	})
+	tracing.End(span, err)
 	if err != nil {
-		return fmt.Errorf("get transaction %v failed, %v", txSig, err)
+		return txInfo, fmt.Errorf("get transaction %v failed, %v", txSig, err)
 	}
 	if tx == nil || tx.Meta == nil {
-		return fmt.Errorf("txSig: %v, get tx detail failed, tx or meta is nil", txSig)
+		return txInfo, fmt.Errorf("txSig: %v, get tx detail failed, tx or meta is nil", txSig)
+	}
+	txInfo.TxDetail = tx
+	return txInfo, nil
+}
+
+// toTransactionResult slot, block time and the meta without inner instructions and loaded addresses
+// of the jsonParsed transaction, the transaction is nil
+func toTransactionResult(parsed *rpc.GetParsedTransactionResult) *rpc.GetTransactionResult {
+	return &rpc.GetTransactionResult{
+		Slot:      parsed.Slot,
+		BlockTime: parsed.BlockTime,
+		Version:   parsed.Version,
+		Meta: &rpc.TransactionMeta{
+			Err:               parsed.Meta.Err,
+			Fee:               parsed.Meta.Fee,
+			PreBalances:       parsed.Meta.PreBalances,
+			PostBalances:      parsed.Meta.PostBalances,
+			PreTokenBalances:  parsed.Meta.PreTokenBalances,
+			PostTokenBalances: parsed.Meta.PostTokenBalances,
+			LogMessages:       parsed.Meta.LogMessages,
+		},
+	}
+}
+
+func (c *Contract) handleTx(ctx context.Context, client *rpcclient.SolClient, txSig solana.Signature) error {
+	txInfo, err := c.getTransaction(ctx, client, txSig)
+	if err != nil {
+		return err
+	}
+	if txInfo.TxDetail.Meta.Err != nil {
+		return c.callFailedTx(ctx, client, txInfo)
 	}
 
-	programDatas, err := getDataBytesFromLogs(tx.Meta.LogMessages)
+	programDatas, err := getProgramDatasFromLogs(txInfo.TxDetail.Meta.LogMessages)
 	if err != nil {
 		return fmt.Errorf("txSig: %v, get data bytes from logs failed, %v", txSig, err)
 	}
 
-	for eventIdx, dataBytes := range programDatas {
+	var eventIdx uint64
+	for _, programData := range programDatas {
+		// only the events emitted by ProgramId
+		if !programData.ProgramId.Equals(c.ProgramId) {
+			continue
+		}
+		dataBytes := programData.DataBytes
+
 		// Determine the name of the event
 		if len(dataBytes) < 8 {
 			continue
 		}
 		methodHash := dataBytes[:8]
 
-		err := c.HandleEvent(client, Event(methodHash), TxInfo{
-			ProgramId:  c.ProgramId,
-			TxSig:      txSig,
-			TxDetail:   tx,
-			DataBytes:  dataBytes,
-			EventIndex: uint64(eventIdx),
-		})
+		eventInfo := txInfo
+		eventInfo.DataBytes = dataBytes
+		eventInfo.EventIndex = eventIdx
+		eventInfo.InvokeDepth = programData.InvokeDepth
+		err := c.callEvent(ctx, client, Event(methodHash), eventInfo)
 		if err != nil {
 			return err
 		}
+		eventIdx++
 
 		//err = utils.UnmarshalBorsh(dataBytes, obj)
 		//if err != nil {
@@ -91,29 +208,71 @@ func (c *Contract) handleTx(client *rpcclient.SolClient, txSig solana.Signature)
 		//}
 	}
 
-	return nil
+	err = c.handleInstructions(ctx, client, txInfo)
+	if err != nil {
+		return err
+	}
+
+	return c.callTx(ctx, client, txInfo)
 }
 
-func getDataBytesFromLogs(logs []string) ([][]byte, error) {
-	programDatas := make([][]byte, 0, len(logs))
+type programData struct {
+	ProgramId   solana.PublicKey // the program that emitted the data
+	InvokeDepth int              // invocation depth of the program, top-level is 1
+	DataBytes   []byte
+}
+
+// getProgramDatasFromLogs parse "Program data:" logs,
+// each data is attributed to the program on the top of the invocation stack
+//
+//	Program <id> invoke [<depth>]
+//	Program data: <base64>
+//	Program <id> success | Program <id> failed: <err>
+func getProgramDatasFromLogs(logs []string) ([]programData, error) {
+	programDatas := make([]programData, 0, len(logs))
+	stack := make([]solana.PublicKey, 0, 4)
 	for _, l := range logs {
 		// Check whether the event starts with xx
-		if !strings.HasPrefix(l, utils.ProgramDataPrefix) {
+		if strings.HasPrefix(l, utils.ProgramDataPrefix) {
+			if len(stack) == 0 {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(l, utils.ProgramDataPrefix))
+			dataBytes, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				return nil, err
+			}
+
+			programDatas = append(programDatas, programData{
+				ProgramId:   stack[len(stack)-1],
+				InvokeDepth: len(stack),
+				DataBytes:   dataBytes,
+			})
 			continue
 		}
 
-		split := strings.Split(l, ":")
-		if len(split) != 2 {
+		if !strings.HasPrefix(l, utils.ProgramLogPrefix) {
 			continue
 		}
-		programData := strings.TrimSpace(split[1])
-
-		dataBytes, err := base64.StdEncoding.DecodeString(programData)
-		if err != nil {
-			return nil, err
+		fields := strings.Fields(l)
+		if len(fields) < 3 {
+			continue
+		}
+		switch {
+		case fields[2] == "invoke" && len(fields) == 4:
+			programId, err := solana.PublicKeyFromBase58(fields[1])
+			if err != nil {
+				continue
+			}
+			stack = append(stack, programId)
+		case fields[2] == "success" || fields[2] == "failed:":
+			// "Program log: success ..." of a program is not the end of the invocation
+			programId, err := solana.PublicKeyFromBase58(fields[1])
+			if err != nil || len(stack) == 0 || !programId.Equals(stack[len(stack)-1]) {
+				continue
+			}
+			stack = stack[:len(stack)-1]
 		}
-
-		programDatas = append(programDatas, dataBytes)
 	}
 
 	if len(programDatas) == 0 {
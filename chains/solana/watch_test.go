@@ -66,3 +66,48 @@ func TestWatch(t *testing.T) {
 	contract.Close()
 	client.Close()
 }
+
+func TestGetProgramDatasFromLogs(t *testing.T) {
+	watched := solana.NewWallet().PublicKey()
+	other := solana.NewWallet().PublicKey()
+	logs := []string{
+		"Program " + other.String() + " invoke [1]",
+		"Program log: Instruction: Swap",
+		"Program data: AQID",
+		"Program " + watched.String() + " invoke [2]",
+		"Program log: success of the swap",
+		"Program data: BAUG",
+		"Program " + watched.String() + " consumed 2000 of 190000 compute units",
+		"Program " + watched.String() + " success",
+		"Program data: BwgJ",
+		"Program " + other.String() + " success",
+		"Program " + watched.String() + " invoke [1]",
+		"Program data: CgsM",
+		"Program " + watched.String() + " failed: custom program error: 0x1",
+	}
+
+	programDatas, err := getProgramDatasFromLogs(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(programDatas) != 4 {
+		t.Fatalf("expected 4 program datas, got %d", len(programDatas))
+	}
+
+	expected := []struct {
+		programId solana.PublicKey
+		depth     int
+		data      byte
+	}{
+		{other, 1, 1},
+		{watched, 2, 4},
+		{other, 1, 7},
+		{watched, 1, 10},
+	}
+	for i, e := range expected {
+		d := programDatas[i]
+		if !d.ProgramId.Equals(e.programId) || d.InvokeDepth != e.depth || d.DataBytes[0] != e.data {
+			t.Fatalf("program data %d: got %v depth %d data %v", i, d.ProgramId, d.InvokeDepth, d.DataBytes)
+		}
+	}
+}
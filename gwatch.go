@@ -4,9 +4,12 @@ import (
 	"errors"
 
 	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/calls"
 	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc20"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/native"
 	"github.com/AcSunday/gwatch-chain/loadbalance"
 	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 )
@@ -20,7 +23,21 @@ type IWatch interface {
 	DoneSignal() <-chan struct{}
 	RegisterWatchEvent(events ...abs.Event) error
 	RegisterWatchTopics(topicsIndex int, topics ...common.Hash) error
+	RegisterFilter(f *abs.Filter) error
+	AddAddresses(startBlock uint64, addrs ...common.Address) error
+	RemoveAddresses(addrs ...common.Address) error
+	Addresses() []common.Address
+	RegisterFactory(event abs.Event, f abs.FactoryFunc) error
+	AddChildren(children ...abs.Child) error
 	RegisterEventHook(event abs.Event, f func(client *rpcclient.EvmClient, log types.Log) error) error
+	RegisterEventHookContext(event abs.Event, f abs.HookFunc) error
+	AddEventHook(event abs.Event, f abs.HookFunc) (abs.Unregister, error)
+	AddUnhandledEventHook(f abs.HookFunc) (abs.Unregister, error)
+	Use(mws ...abs.Middleware) error
+	UseEvent(event abs.Event, mws ...abs.Middleware) error
+	RegisterSink(s abs.Sink) error
+	Events() <-chan abs.EventEnvelope
+	Ack(e abs.EventEnvelope) error
 	UpdateProcessedBlockNumber(num uint64) error
 	GetProcessedBlockNumber() uint64
 	GetContractDesc(addr string) (abs.ContractDesc, error)
@@ -62,7 +79,7 @@ func (w *watch) Close() error {
 }
 
 func NewGeneralWatch(rawurls []string, addrs []common.Address, ops *Options) (IWatch, error) {
-	l := loadbalance.New(rawurls, rpcclient.NewEvmRpcClient)
+	l := loadbalance.New(rawurls, rpcclient.NewEvmRpcClient, loadbalance.WithLogger(ops.Logger), loadbalance.WithChain(ops.Chain))
 
 	e := erc20.New(addrs, &ops.Attrs)
 	e.ChainId = l.GetChainId()
@@ -76,3 +93,23 @@ func NewLoadBalanceGeneralWatch(lb loadbalance.LoadBalance[*rpcclient.EvmClient]
 
 	return &watch{lb: lb, IContract: e}, nil
 }
+
+// NewNativeWatch watches the native transfers from or to addrs, see native.New
+func NewNativeWatch(rawurls []string, addrs []common.Address, trace native.Trace, ops *Options) (IWatch, error) {
+	l := loadbalance.New(rawurls, rpcclient.NewEvmRpcClient, loadbalance.WithLogger(ops.Logger), loadbalance.WithChain(ops.Chain))
+
+	n := native.New(addrs, &ops.Attrs, trace)
+	n.ChainId = l.GetChainId()
+
+	return &watch{lb: l, IContract: n}, nil
+}
+
+// NewCallWatch watches the transactions calling addrs decoded by contractABI, see calls.New
+func NewCallWatch(rawurls []string, addrs []common.Address, contractABI abi.ABI, ops *Options) (IWatch, error) {
+	l := loadbalance.New(rawurls, rpcclient.NewEvmRpcClient, loadbalance.WithLogger(ops.Logger), loadbalance.WithChain(ops.Chain))
+
+	c := calls.New(addrs, &ops.Attrs, contractABI)
+	c.ChainId = l.GetChainId()
+
+	return &watch{lb: l, IContract: c}, nil
+}
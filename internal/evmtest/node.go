@@ -0,0 +1,336 @@
+// Package evmtest mock evm json-rpc node for tests
+package evmtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// BaseBlockTime block time of block 0, a block every 12 seconds
+const BaseBlockTime = 1700000000
+
+// Node serves eth_chainId, eth_blockNumber, eth_getLogs, eth_getBlockByNumber, eth_getBlockByHash, eth_call,
+// eth_getTransactionByHash, eth_getTransactionReceipt, eth_getBlockReceipts, debug_traceBlockByNumber and trace_block, batch requests are supported unless RejectBatch
+type Node struct {
+	chainId    uint64
+	latest     uint64
+	noBatch    bool
+	batchFail  int // http status of the next batch request, see FailNextBatch
+	logs       []types.Log
+	txs        map[uint64][]Tx             // key is block number
+	unknownTxs map[uint64][]map[string]any // see AddUnknownTx
+	maxLogs    int                         // eth_getLogs fails when the result exceeds it
+	results    map[callKey]hexutil.Bytes   // eth_call results
+	fails      map[string]error            // method -> error of the next call
+	missing    map[string]bool             // methods not supported, see DisableMethod
+	traces     map[traceKey]any            // see SetTraces
+	calls      map[string]int
+	mu         sync.Mutex
+
+	server *httptest.Server
+}
+
+func NewNode(tb testing.TB, chainId uint64) *Node {
+	n := &Node{
+		chainId:    chainId,
+		fails:      make(map[string]error),
+		missing:    make(map[string]bool),
+		traces:     make(map[traceKey]any),
+		calls:      make(map[string]int),
+		results:    make(map[callKey]hexutil.Bytes),
+		txs:        make(map[uint64][]Tx),
+		unknownTxs: make(map[uint64][]map[string]any),
+	}
+
+	srv := rpc.NewServer()
+	for name, service := range map[string]any{"eth": &ethService{n: n}, "debug": &debugService{n: n}, "trace": &traceService{n: n}} {
+		if err := srv.RegisterName(name, service); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	n.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if batch := bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")); batch {
+			n.mu.Lock()
+			n.calls[BatchCalls]++
+			noBatch, status := n.noBatch, n.batchFail
+			n.batchFail = 0
+			n.mu.Unlock()
+			if noBatch {
+				http.Error(w, "batch requests are not supported", http.StatusBadRequest)
+				return
+			}
+			if status != 0 {
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		srv.ServeHTTP(w, r)
+	}))
+	tb.Cleanup(func() {
+		n.server.Close()
+		srv.Stop()
+	})
+	return n
+}
+
+func (n *Node) URL() string {
+	return n.server.URL
+}
+
+// Client dial the node
+func (n *Node) Client(tb testing.TB) *rpcclient.EvmClient {
+	c, err := rpcclient.NewEvmRpcClient(n.URL())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(c.Close)
+	return c
+}
+
+func (n *Node) SetLatest(num uint64) {
+	n.mu.Lock()
+	n.latest = num
+	n.mu.Unlock()
+}
+
+func (n *Node) AddLogs(logs ...types.Log) {
+	n.mu.Lock()
+	n.logs = append(n.logs, logs...)
+	n.mu.Unlock()
+}
+
+// SetMaxLogs eth_getLogs fails when the result exceeds n, like the limit of the providers, 0 is unlimited
+func (n *Node) SetMaxLogs(max int) {
+	n.mu.Lock()
+	n.maxLogs = max
+	n.mu.Unlock()
+}
+
+// SetCallResult the result of eth_call to the contract with data, the other calls revert
+func (n *Node) SetCallResult(to common.Address, data, result []byte) {
+	n.mu.Lock()
+	n.results[callKey{to: to, data: string(data)}] = result
+	n.mu.Unlock()
+}
+
+// RejectBatch batch requests fail with http 400, like the providers without batch support
+func (n *Node) RejectBatch() {
+	n.mu.Lock()
+	n.noBatch = true
+	n.mu.Unlock()
+}
+
+// FailNextBatch the next batch request fails with the http status, like a transient error of the provider
+func (n *Node) FailNextBatch(status int) {
+	n.mu.Lock()
+	n.batchFail = status
+	n.mu.Unlock()
+}
+
+// DisableMethod the calls of method fail with method not found, like the providers without the method
+func (n *Node) DisableMethod(method string) {
+	n.mu.Lock()
+	n.missing[method] = true
+	n.mu.Unlock()
+}
+
+// FailNext the next call of method returns err
+func (n *Node) FailNext(method string, err error) {
+	n.mu.Lock()
+	n.fails[method] = err
+	n.mu.Unlock()
+}
+
+// BatchCalls the key of Calls counting the batch requests
+const BatchCalls = "batch"
+
+// Calls number of calls of method, the calls in a batch are counted one by one
+func (n *Node) Calls(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[method]
+}
+
+func (n *Node) call(method string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls[method]++
+	if n.missing[method] {
+		return methodNotFound(method)
+	}
+	if err, ok := n.fails[method]; ok {
+		delete(n.fails, method)
+		return err
+	}
+	return nil
+}
+
+// methodNotFound same as the error of the server
+type methodNotFound string
+
+func (e methodNotFound) Error() string {
+	return fmt.Sprintf("the method %s does not exist/is not available", string(e))
+}
+
+func (e methodNotFound) ErrorCode() int { return -32601 }
+
+type ethService struct {
+	n *Node
+}
+
+func (s *ethService) ChainId() (*hexutil.Big, error) {
+	if err := s.n.call("eth_chainId"); err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(new(big.Int).SetUint64(s.n.chainId)), nil
+}
+
+func (s *ethService) BlockNumber() (hexutil.Uint64, error) {
+	if err := s.n.call("eth_blockNumber"); err != nil {
+		return 0, err
+	}
+	s.n.mu.Lock()
+	defer s.n.mu.Unlock()
+	return hexutil.Uint64(s.n.latest), nil
+}
+
+// BlockTime the timestamp of block number
+func BlockTime(number uint64) uint64 {
+	return BaseBlockTime + number*12
+}
+
+// GetBlockByNumber returns the header and the transactions, see AddTxs
+func (s *ethService) GetBlockByNumber(number rpc.BlockNumber, fullTx bool) (map[string]any, error) {
+	if err := s.n.call("eth_getBlockByNumber"); err != nil {
+		return nil, err
+	}
+
+	s.n.mu.Lock()
+	defer s.n.mu.Unlock()
+	num := uint64(number.Int64())
+	if number < 0 {
+		num = s.n.latest
+	}
+	if num > s.n.latest {
+		return nil, nil
+	}
+	return s.n.block(num, fullTx)
+}
+
+// GetBlockByHash same as GetBlockByNumber, see BlockHash
+func (s *ethService) GetBlockByHash(hash common.Hash, fullTx bool) (map[string]any, error) {
+	if err := s.n.call("eth_getBlockByHash"); err != nil {
+		return nil, err
+	}
+
+	s.n.mu.Lock()
+	defer s.n.mu.Unlock()
+	for num := uint64(0); num <= s.n.latest; num++ {
+		if BlockHash(num) == hash {
+			return s.n.block(num, fullTx)
+		}
+	}
+	return nil, nil
+}
+
+type filterArg struct {
+	FromBlock *hexutil.Big     `json:"fromBlock"`
+	ToBlock   *hexutil.Big     `json:"toBlock"`
+	Address   []common.Address `json:"address"`
+	Topics    [][]common.Hash  `json:"topics"`
+}
+
+func (s *ethService) GetLogs(arg filterArg) ([]types.Log, error) {
+	if err := s.n.call("eth_getLogs"); err != nil {
+		return nil, err
+	}
+	if arg.FromBlock == nil || arg.ToBlock == nil {
+		return nil, errors.New("block range is required")
+	}
+
+	s.n.mu.Lock()
+	defer s.n.mu.Unlock()
+	from, to := arg.FromBlock.ToInt().Uint64(), arg.ToBlock.ToInt().Uint64()
+	res := make([]types.Log, 0)
+	for _, l := range s.n.logs {
+		if l.BlockNumber < from || l.BlockNumber > to || !matchLog(l, arg.Address, arg.Topics) {
+			continue
+		}
+		res = append(res, l)
+	}
+	if s.n.maxLogs > 0 && len(res) > s.n.maxLogs {
+		return nil, fmt.Errorf("query returned more than %d results", s.n.maxLogs)
+	}
+	return res, nil
+}
+
+type callKey struct {
+	to   common.Address
+	data string
+}
+
+type callArg struct {
+	To    *common.Address `json:"to"`
+	Input hexutil.Bytes   `json:"input"`
+	Data  hexutil.Bytes   `json:"data"`
+}
+
+func (s *ethService) Call(arg callArg, block *rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	if err := s.n.call("eth_call"); err != nil {
+		return nil, err
+	}
+	if arg.To == nil {
+		return nil, errors.New("contract creation is not supported")
+	}
+	data := arg.Input
+	if len(data) == 0 {
+		data = arg.Data
+	}
+
+	s.n.mu.Lock()
+	defer s.n.mu.Unlock()
+	res, ok := s.n.results[callKey{to: *arg.To, data: string(data)}]
+	if !ok {
+		return nil, errors.New("execution reverted")
+	}
+	return res, nil
+}
+
+func matchLog(l types.Log, addrs []common.Address, topics [][]common.Hash) bool {
+	if len(addrs) > 0 && !contains(addrs, l.Address) {
+		return false
+	}
+	if len(topics) > len(l.Topics) {
+		return false
+	}
+	for i, sub := range topics {
+		if len(sub) > 0 && !contains(sub, l.Topics[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains[T comparable](sli []T, v T) bool {
+	for _, e := range sli {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+package evmtest
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tx transaction of a block, the receipt has the logs of the transaction
+type Tx struct {
+	*types.Transaction
+	From    common.Address
+	Failed  bool // status of the receipt
+	GasUsed uint64
+}
+
+// AddTxs appends the transactions of block number
+func (n *Node) AddTxs(number uint64, txs ...Tx) {
+	n.mu.Lock()
+	n.txs[number] = append(n.txs[number], txs...)
+	n.mu.Unlock()
+}
+
+// AddUnknownTx appends a transaction of a type go-ethereum does not decode to the full transactions of block number,
+// like the deposit transaction of op chains
+func (n *Node) AddUnknownTx(number uint64, hash common.Hash) {
+	n.mu.Lock()
+	n.unknownTxs[number] = append(n.unknownTxs[number], map[string]any{
+		"type": "0x7e", "hash": hash, "from": common.Address{}, "sourceHash": common.Hash{1},
+		"blockNumber": hexutil.Uint64(number), "blockHash": BlockHash(number),
+	})
+	n.mu.Unlock()
+}
+
+// BlockHash the hash of block number
+func BlockHash(number uint64) common.Hash {
+	return header(number).Hash()
+}
+
+// header of block num
+func header(num uint64) *types.Header {
+	return &types.Header{
+		Number:     new(big.Int).SetUint64(num),
+		Time:       BlockTime(num),
+		Difficulty: new(big.Int),
+	}
+}
+
+// block the json of the block, mu is held
+func (n *Node) block(num uint64, fullTx bool) (map[string]any, error) {
+	header := header(num)
+	block, err := toMap(header)
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]any, 0, len(n.txs[num]))
+	for i, tx := range n.txs[num] {
+		if !fullTx {
+			txs = append(txs, tx.Hash())
+			continue
+		}
+		v, err := n.rpcTx(header, uint(i), tx)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, v)
+	}
+	if fullTx {
+		for _, v := range n.unknownTxs[num] {
+			txs = append(txs, v)
+		}
+	}
+	block["transactions"] = txs
+	return block, nil
+}
+
+// rpcTx the json of the transaction with the block fields and the sender
+func (n *Node) rpcTx(header *types.Header, index uint, tx Tx) (map[string]any, error) {
+	v, err := toMap(tx.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	v["from"] = tx.From
+	v["blockHash"] = header.Hash()
+	v["blockNumber"] = (*hexutil.Big)(header.Number)
+	v["transactionIndex"] = hexutil.Uint(index)
+	return v, nil
+}
+
+// findTx mu is held
+func (n *Node) findTx(hash common.Hash) (uint64, uint, Tx, bool) {
+	for num, txs := range n.txs {
+		for i, tx := range txs {
+			if tx.Hash() == hash {
+				return num, uint(i), tx, true
+			}
+		}
+	}
+	return 0, 0, Tx{}, false
+}
+
+func (n *Node) receipt(num uint64, index uint, tx Tx) *types.Receipt {
+	header := header(num)
+	r := &types.Receipt{
+		Type:              tx.Type(),
+		Status:            types.ReceiptStatusSuccessful,
+		CumulativeGasUsed: tx.GasUsed,
+		GasUsed:           tx.GasUsed,
+		TxHash:            tx.Hash(),
+		BlockHash:         header.Hash(),
+		BlockNumber:       header.Number,
+		TransactionIndex:  index,
+		Logs:              make([]*types.Log, 0),
+	}
+	if tx.Failed {
+		r.Status = types.ReceiptStatusFailed
+	}
+	for _, l := range n.logs {
+		if l.TxHash == r.TxHash {
+			r.Logs = append(r.Logs, &l)
+		}
+	}
+	r.Bloom = types.CreateBloom(r)
+	return r
+}
+
+func (s *ethService) GetTransactionByHash(hash common.Hash) (map[string]any, error) {
+	if err := s.n.call("eth_getTransactionByHash"); err != nil {
+		return nil, err
+	}
+
+	s.n.mu.Lock()
+	defer s.n.mu.Unlock()
+	num, index, tx, ok := s.n.findTx(hash)
+	if !ok {
+		return nil, nil
+	}
+	return s.n.rpcTx(header(num), index, tx)
+}
+
+func (s *ethService) GetTransactionReceipt(hash common.Hash) (*types.Receipt, error) {
+	if err := s.n.call("eth_getTransactionReceipt"); err != nil {
+		return nil, err
+	}
+
+	s.n.mu.Lock()
+	defer s.n.mu.Unlock()
+	num, index, tx, ok := s.n.findTx(hash)
+	if !ok {
+		return nil, nil
+	}
+	return s.n.receipt(num, index, tx), nil
+}
+
+func toMap(v any) (map[string]any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	return m, json.Unmarshal(b, &m)
+}
+
+func (s *ethService) GetBlockReceipts(number rpc.BlockNumber) ([]*types.Receipt, error) {
+	if err := s.n.call("eth_getBlockReceipts"); err != nil {
+		return nil, err
+	}
+
+	s.n.mu.Lock()
+	defer s.n.mu.Unlock()
+	num := uint64(number.Int64())
+	if number < 0 {
+		num = s.n.latest
+	}
+	if num > s.n.latest {
+		return nil, nil
+	}
+	receipts := make([]*types.Receipt, 0, len(s.n.txs[num]))
+	for i, tx := range s.n.txs[num] {
+		receipts = append(receipts, s.n.receipt(num, uint(i), tx))
+	}
+	return receipts, nil
+}
+
+type traceKey struct {
+	method string
+	number uint64
+}
+
+// SetTraces the result of debug_traceBlockByNumber or trace_block of block number, the default is empty
+func (n *Node) SetTraces(method string, number uint64, result any) {
+	n.mu.Lock()
+	n.traces[traceKey{method: method, number: number}] = result
+	n.mu.Unlock()
+}
+
+func (n *Node) trace(method string, number rpc.BlockNumber) (any, error) {
+	if err := n.call(method); err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if res, ok := n.traces[traceKey{method: method, number: uint64(number.Int64())}]; ok {
+		return res, nil
+	}
+	return []any{}, nil
+}
+
+type debugService struct {
+	n *Node
+}
+
+// TraceBlockByNumber the tracer of config is ignored
+func (s *debugService) TraceBlockByNumber(number rpc.BlockNumber, config map[string]any) (any, error) {
+	return s.n.trace("debug_traceBlockByNumber", number)
+}
+
+type traceService struct {
+	n *Node
+}
+
+func (s *traceService) Block(number rpc.BlockNumber) (any, error) {
+	return s.n.trace("trace_block", number)
+}
@@ -2,11 +2,13 @@ package loadbalance
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/AcSunday/gwatch-chain/metrics"
 )
 
 const (
@@ -67,6 +69,7 @@ type nodeInfo[T RPCClient] struct {
 
 // loadBalance 负载均衡器实现
 type loadBalance[T RPCClient] struct {
+	chain        string
 	chainId      uint64
 	urls         []string
 	nodes        []*nodeInfo[T]
@@ -75,10 +78,40 @@ type loadBalance[T RPCClient] struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 	factory      ClientFactory[T]
+	logger       *slog.Logger
+}
+
+// Option 负载均衡器选项
+type Option func(o *options)
+
+type options struct {
+	logger *slog.Logger
+	chain  string
+}
+
+// WithChain 链名称，用于监控指标的chain标签，见 metrics.ChainLabel
+func WithChain(chain string) Option {
+	return func(o *options) {
+		o.chain = chain
+	}
+}
+
+// WithLogger 结构化日志，默认为 slog.Default()
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
 }
 
 // New 创建新的负载均衡器
-func New[T RPCClient](urls []string, factory ClientFactory[T]) LoadBalance[T] {
+func New[T RPCClient](urls []string, factory ClientFactory[T], opts ...Option) LoadBalance[T] {
+	o := options{logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	if len(urls) == 0 {
 		return nil
 	}
@@ -86,12 +119,14 @@ func New[T RPCClient](urls []string, factory ClientFactory[T]) LoadBalance[T] {
 	// 创建第一个客户端
 	cli, err := factory(urls[0])
 	if err != nil {
+		o.logger.Error("failed to connect to the first node", "node", metrics.NodeLabel(urls[0]), "err", err)
 		return nil
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	l := &loadBalance[T]{
+		chain:   o.chain,
 		chainId: cli.GetChainId(),
 		urls:    urls,
 		nodes:   make([]*nodeInfo[T], len(urls)),
@@ -99,14 +134,18 @@ func New[T RPCClient](urls []string, factory ClientFactory[T]) LoadBalance[T] {
 		cancel:  cancel,
 		factory: factory,
 	}
+	l.logger = o.logger.With("chain_id", l.chainId)
 
 	// 初始化节点信息
 	l.nodes[0] = &nodeInfo[T]{client: cli}
 
 	for i := 1; i < len(urls); i++ {
-		if client, err := factory(urls[i]); err == nil {
-			l.nodes[i] = &nodeInfo[T]{client: client}
+		client, err := factory(urls[i])
+		if err != nil {
+			l.logger.Warn("failed to connect to node", "node", metrics.NodeLabel(urls[i]), "err", err)
+			continue
 		}
+		l.nodes[i] = &nodeInfo[T]{client: client}
 	}
 
 	// 初始化快照
@@ -127,7 +166,10 @@ func (l *loadBalance[T]) updateNodesSnapshot() {
 	}
 	if len(healthyNodes) > 0 {
 		l.nodeSnapshot.Store(healthyNodes)
+	} else {
+		l.logger.Error("no healthy nodes, keep the last healthy nodes", "nodes", len(l.nodes))
 	}
+	metrics.Default().HealthyNodes(metrics.ChainLabel(l.chain, l.chainId), len(healthyNodes))
 }
 
 // isZero 检查客户端是否为零值
@@ -159,7 +201,7 @@ func (l *loadBalance[T]) parallelHealthCheck() {
 			defer wg.Done()
 			defer func() {
 				if r := recover(); r != nil {
-					log.Printf("health check panic recovered: %v", r)
+					l.logger.Error("health check panic recovered", "node", metrics.NodeLabel(l.urls[idx]), "panic", r)
 				}
 			}()
 
@@ -176,7 +218,9 @@ func (l *loadBalance[T]) parallelHealthCheck() {
 
 			if !isHealthy(l.urls[idx]) {
 				unhealthyCnt := node.unhealthyCnt.Add(1)
+				l.logger.Warn("node unhealthy", "node", metrics.NodeLabel(l.urls[idx]), "unhealthy_count", unhealthyCnt)
 				if unhealthyCnt >= unhealthyTolerateVal {
+					l.logger.Warn("node evicted", "node", metrics.NodeLabel(l.urls[idx]), "in_flight", node.refCount.Load())
 					oldClient := node.client
 					var zero T
 					node.client = zero
@@ -192,8 +236,16 @@ func (l *loadBalance[T]) parallelHealthCheck() {
 				node.lastCheck.Store(now)
 
 				if l.isZero(node.client) {
-					if newClient, err := l.factory(l.urls[idx]); err == nil && l.chainId == newClient.GetChainId() {
+					newClient, err := l.factory(l.urls[idx])
+					switch {
+					case err != nil:
+						l.logger.Warn("failed to reconnect node", "node", metrics.NodeLabel(l.urls[idx]), "err", err)
+					case l.chainId != newClient.GetChainId():
+						l.logger.Error("node chain id mismatch", "node", metrics.NodeLabel(l.urls[idx]), "node_chain_id", newClient.GetChainId())
+						newClient.Close()
+					default:
 						node.client = newClient
+						l.logger.Info("node reconnected", "node", metrics.NodeLabel(l.urls[idx]))
 					}
 				}
 			}
@@ -207,7 +259,7 @@ func (l *loadBalance[T]) parallelHealthCheck() {
 func (l *loadBalance[T]) delayedClosing(cli T) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("delayed closing panic recovered: %v", r)
+			l.logger.Error("delayed closing panic recovered", "node", metrics.NodeLabel(cli.GetRawUrl()), "panic", r)
 		}
 	}()
 
@@ -282,14 +334,19 @@ func (l *loadBalance[T]) NextClient() T {
 	// 使用 Uint32，永远为正数
 	idx := l.currentIndex.Add(1)
 	node := nodes[idx%uint32(len(nodes))]
-	node.refCount.Add(1)
-	return node.client
+	refs := node.refCount.Add(1)
+	cli := node.client
+	if !l.isZero(cli) {
+		metrics.Default().InFlight(metrics.NodeLabel(cli.GetRawUrl()), int(refs))
+	}
+	return cli
 }
 
 func (l *loadBalance[T]) ReleaseClient(cli T) {
 	for _, node := range l.nodes {
 		if node != nil && !l.isZero(node.client) && node.client == cli {
-			node.refCount.Add(-1)
+			refs := node.refCount.Add(-1)
+			metrics.Default().InFlight(metrics.NodeLabel(cli.GetRawUrl()), int(refs))
 			return
 		}
 	}
@@ -340,8 +397,8 @@ func (l *loadBalance[T]) Close() {
 
 	select {
 	case <-ctx.Done():
-		// log.Printf("load balancer close timeout after 10s")
+		l.logger.Warn("load balancer close timeout, clients in use are closed")
 	case <-waitCh:
-		// log.Printf("load balancer closed gracefully")
+		l.logger.Debug("load balancer closed")
 	}
 }
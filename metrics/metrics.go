@@ -0,0 +1,93 @@
+// Package metrics collects the metrics of scanners, rpc nodes and load balancers,
+// the collector is Nop by default, see SetCollector and the Prometheus adapter metrics/prom
+package metrics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type Collector interface {
+	// Scan after every scan of a watcher, lag is head - processed, logs is the number of logs of the scanned range
+	Scan(chain, watcher string, head, processed uint64, logs int)
+	// Hook latency of an event hook of a watcher
+	Hook(chain, watcher, event string, d time.Duration, err error)
+	// RPC latency of a json-rpc call
+	RPC(node, method string, d time.Duration, err error)
+	// HealthyNodes the number of healthy nodes of the load balancer
+	HealthyNodes(chain string, n int)
+	// InFlight the number of clients of node in use
+	InFlight(node string, refs int)
+}
+
+// Nop discards all metrics
+type Nop struct{}
+
+func (Nop) Scan(string, string, uint64, uint64, int)          {}
+func (Nop) Hook(string, string, string, time.Duration, error) {}
+func (Nop) RPC(string, string, time.Duration, error)          {}
+func (Nop) HealthyNodes(string, int)                          {}
+func (Nop) InFlight(string, int)                              {}
+
+type holder struct {
+	Collector
+}
+
+var collector atomic.Value // holder
+
+func init() {
+	collector.Store(holder{Nop{}})
+}
+
+// SetCollector the collector of all scanners, rpc clients and load balancers, nil resets to Nop
+func SetCollector(c Collector) {
+	if c == nil {
+		c = Nop{}
+	}
+	collector.Store(holder{c})
+}
+
+// Default the collector set by SetCollector
+func Default() Collector {
+	return collector.Load().(holder).Collector
+}
+
+// ChainLabel chain name, or chain id if the name is empty
+func ChainLabel(chain string, chainId uint64) string {
+	if chain != "" {
+		return chain
+	}
+	return strconv.FormatUint(chainId, 10)
+}
+
+// WatcherLabel name of the watcher, or the watched address, or a short hash of the watched addresses,
+// the watchers of a chain need distinct labels, otherwise their gauges overwrite each other
+func WatcherLabel(name string, addrs ...string) string {
+	switch {
+	case name != "":
+		return name
+	case len(addrs) == 0:
+		return "all"
+	case len(addrs) == 1:
+		return addrs[0]
+	}
+	sorted := slices.Clone(addrs)
+	slices.Sort(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, ",")))
+	return "addrs-" + hex.EncodeToString(sum[:8])
+}
+
+// NodeLabel scheme and host of the rpc url, the path and query may contain api keys
+func NodeLabel(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,80 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/AcSunday/gwatch-chain/metrics"
+	"github.com/ethereum/go-ethereum"
+)
+
+type rpcCall struct {
+	node, method string
+	err          error
+}
+
+type recorder struct {
+	metrics.Nop
+	mu    sync.Mutex
+	calls []rpcCall
+}
+
+func (r *recorder) RPC(node, method string, d time.Duration, err error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, rpcCall{node: node, method: method, err: err})
+	r.mu.Unlock()
+}
+
+func TestTransport(t *testing.T) {
+	r := &recorder{}
+	metrics.SetCollector(r)
+	defer metrics.SetCollector(nil)
+
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(10)
+	client := node.Client(t)
+
+	if _, err := client.BlockNumber(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	node.FailNext("eth_getLogs", errors.New("limit exceeded"))
+	if _, err := client.FilterLogs(context.Background(), ethereum.FilterQuery{}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// eth_chainId of dial, eth_blockNumber, eth_getLogs
+	if len(r.calls) != 3 {
+		t.Fatalf("expected 3 calls, got %+v", r.calls)
+	}
+	if r.calls[1].method != "eth_blockNumber" || r.calls[1].err != nil || r.calls[1].node != metrics.NodeLabel(node.URL()) {
+		t.Fatalf("unexpected call: %+v", r.calls[1])
+	}
+	if r.calls[2].method != "eth_getLogs" || r.calls[2].err == nil {
+		t.Fatalf("unexpected call: %+v", r.calls[2])
+	}
+}
+
+func TestWatcherLabel(t *testing.T) {
+	a, b := "0x55d398326f99059fF775485246999027B3197955", "0x8AC76a51cc950d9822D68b83fE1Ad97B32Cd580d"
+	if l := metrics.WatcherLabel("usdt", a); l != "usdt" {
+		t.Fatalf("unexpected label %s", l)
+	}
+	if l := metrics.WatcherLabel("", a); l != a {
+		t.Fatalf("unexpected label %s", l)
+	}
+	if metrics.WatcherLabel("", a, b) != metrics.WatcherLabel("", b, a) || metrics.WatcherLabel("", a, b) == metrics.WatcherLabel("", a) {
+		t.Fatal("the label of an address set is not unique")
+	}
+}
+
+func TestNodeLabel(t *testing.T) {
+	if l := metrics.NodeLabel("https://mainnet.infura.io/v3/secret-key"); l != "https://mainnet.infura.io" {
+		t.Fatalf("unexpected label %s", l)
+	}
+}
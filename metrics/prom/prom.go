@@ -0,0 +1,111 @@
+// Package prom Prometheus adapter of metrics.Collector
+package prom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "gwatch"
+
+type Collector struct {
+	headBlock      *prometheus.GaugeVec
+	processedBlock *prometheus.GaugeVec
+	lag            *prometheus.GaugeVec
+	scanLogs       *prometheus.HistogramVec
+	hookDuration   *prometheus.HistogramVec
+	hookErrors     *prometheus.CounterVec
+	rpcDuration    *prometheus.HistogramVec
+	rpcErrors      *prometheus.CounterVec
+	healthyNodes   *prometheus.GaugeVec
+	inFlight       *prometheus.GaugeVec
+}
+
+// New registers the metrics to reg, use prometheus.DefaultRegisterer if reg is nil
+//
+//	metrics.SetCollector(c)
+func New(reg prometheus.Registerer) (*Collector, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	c := &Collector{
+		headBlock: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "head_block", Help: "Latest block number of the chain.",
+		}, []string{"chain"}),
+		processedBlock: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "processed_block", Help: "Processed block number of the scanner.",
+		}, []string{"chain", "watcher"}),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "lag_blocks", Help: "Head block minus processed block.",
+		}, []string{"chain", "watcher"}),
+		scanLogs: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "scan_logs", Help: "Number of logs per scan.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+		}, []string{"chain", "watcher"}),
+		hookDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "hook_duration_seconds", Help: "Latency of event hooks.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"chain", "watcher", "event"}),
+		hookErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "hook_errors_total", Help: "Errors returned by event hooks.",
+		}, []string{"chain", "watcher", "event"}),
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "rpc_duration_seconds", Help: "Latency of json-rpc calls.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"node", "method"}),
+		rpcErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "rpc_errors_total", Help: "Failed json-rpc calls.",
+		}, []string{"node", "method"}),
+		healthyNodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "healthy_nodes", Help: "Number of healthy nodes of the load balancer.",
+		}, []string{"chain"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "inflight_refs", Help: "Number of clients of the node in use.",
+		}, []string{"node"}),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		c.headBlock, c.processedBlock, c.lag, c.scanLogs, c.hookDuration, c.hookErrors,
+		c.rpcDuration, c.rpcErrors, c.healthyNodes, c.inFlight,
+	} {
+		if err := reg.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Collector) Scan(chain, watcher string, head, processed uint64, logs int) {
+	c.headBlock.WithLabelValues(chain).Set(float64(head))
+	c.processedBlock.WithLabelValues(chain, watcher).Set(float64(processed))
+	var lag uint64
+	if head > processed {
+		lag = head - processed
+	}
+	c.lag.WithLabelValues(chain, watcher).Set(float64(lag))
+	c.scanLogs.WithLabelValues(chain, watcher).Observe(float64(logs))
+}
+
+func (c *Collector) Hook(chain, watcher, event string, d time.Duration, err error) {
+	c.hookDuration.WithLabelValues(chain, watcher, event).Observe(d.Seconds())
+	if err != nil {
+		c.hookErrors.WithLabelValues(chain, watcher, event).Inc()
+	}
+}
+
+func (c *Collector) RPC(node, method string, d time.Duration, err error) {
+	c.rpcDuration.WithLabelValues(node, method).Observe(d.Seconds())
+	if err != nil {
+		c.rpcErrors.WithLabelValues(node, method).Inc()
+	}
+}
+
+func (c *Collector) HealthyNodes(chain string, n int) {
+	c.healthyNodes.WithLabelValues(chain).Set(float64(n))
+}
+
+func (c *Collector) InFlight(node string, refs int) {
+	c.inFlight.WithLabelValues(node).Set(float64(refs))
+}
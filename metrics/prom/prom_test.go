@@ -0,0 +1,39 @@
+package prom
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	c, err := New(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Scan("bsc", "usdt", 120, 100, 3)
+	c.Scan("bsc", "native", 120, 90, 0)
+	c.Hook("bsc", "usdt", "0xddf2", time.Millisecond, errors.New("db down"))
+	c.RPC("https://bsc.node", "eth_getLogs", time.Millisecond, nil)
+	c.HealthyNodes("bsc", 2)
+
+	if v := testutil.ToFloat64(c.lag.WithLabelValues("bsc", "usdt")); v != 20 {
+		t.Fatalf("unexpected lag %v", v)
+	}
+	if v := testutil.ToFloat64(c.lag.WithLabelValues("bsc", "native")); v != 30 {
+		t.Fatalf("unexpected lag %v", v)
+	}
+	if v := testutil.ToFloat64(c.hookErrors.WithLabelValues("bsc", "usdt", "0xddf2")); v != 1 {
+		t.Fatalf("unexpected hook errors %v", v)
+	}
+	if v := testutil.ToFloat64(c.rpcErrors.WithLabelValues("https://bsc.node", "eth_getLogs")); v != 0 {
+		t.Fatalf("unexpected rpc errors %v", v)
+	}
+	if v := testutil.ToFloat64(c.healthyNodes.WithLabelValues("bsc")); v != 2 {
+		t.Fatalf("unexpected healthy nodes %v", v)
+	}
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type rpcRequest struct {
+	Id     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+type rpcResponse struct {
+	Id    json.RawMessage `json:"id"`
+	Error json.RawMessage `json:"error"`
+}
+
+// Transport reports the latency and errors of every json-rpc call to the Default collector,
+// a batch request reports every call of the batch
+type Transport struct {
+	Node string // see NodeLabel
+	Base http.RoundTripper
+}
+
+func NewTransport(rawurl string, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Node: NodeLabel(rawurl), Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Method != http.MethodPost {
+		return t.Base.RoundTrip(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	calls := parseRequest(body)
+
+	start := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		t.report(calls, time.Since(start), nil, err)
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.report(calls, time.Since(start), nil, fmt.Errorf("unexpected status %s", resp.Status))
+		return resp, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	d := time.Since(start)
+	if err != nil {
+		t.report(calls, d, nil, err)
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	t.report(calls, d, parseErrors(respBody), nil)
+	return resp, nil
+}
+
+// report errs key is the id of the failed call
+func (t *Transport) report(calls []rpcRequest, d time.Duration, errs map[string]error, err error) {
+	c := Default()
+	for _, call := range calls {
+		callErr := err
+		if e, ok := errs[string(call.Id)]; ok {
+			callErr = e
+		}
+		c.RPC(t.Node, call.Method, d, callErr)
+	}
+}
+
+func parseRequest(body []byte) []rpcRequest {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var calls []rpcRequest
+		if json.Unmarshal(body, &calls) == nil {
+			return calls
+		}
+	}
+	var call rpcRequest
+	if json.Unmarshal(body, &call) != nil || call.Method == "" {
+		call.Method = "unknown"
+	}
+	return []rpcRequest{call}
+}
+
+func parseErrors(body []byte) map[string]error {
+	body = bytes.TrimSpace(body)
+	var responses []rpcResponse
+	if len(body) > 0 && body[0] == '[' {
+		if json.Unmarshal(body, &responses) != nil {
+			return nil
+		}
+	} else {
+		var resp rpcResponse
+		if json.Unmarshal(body, &resp) != nil {
+			return nil
+		}
+		responses = append(responses, resp)
+	}
+
+	var errs map[string]error
+	for _, resp := range responses {
+		if len(resp.Error) == 0 || string(resp.Error) == "null" {
+			continue
+		}
+		if errs == nil {
+			errs = make(map[string]error)
+		}
+		errs[string(resp.Id)] = errors.New(string(resp.Error))
+	}
+	return errs
+}
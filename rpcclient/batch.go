@@ -0,0 +1,266 @@
+package rpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// DefaultBatchSize calls per json-rpc batch, most providers accept 100
+const DefaultBatchSize = 100
+
+// SetBatchSize calls per json-rpc batch, the limit of the provider, 1 disables batch requests
+func (c *EvmClient) SetBatchSize(n int) {
+	if n <= 0 {
+		n = DefaultBatchSize
+	}
+	c.batchSize.Store(int64(n))
+}
+
+// BatchSize calls per json-rpc batch, DefaultBatchSize if the client is not built by NewEvmRpcClient
+func (c *EvmClient) BatchSize() int {
+	if n := c.batchSize.Load(); n > 0 {
+		return int(n)
+	}
+	return DefaultBatchSize
+}
+
+// BatchCall sends the calls in json-rpc batches of BatchSize, the error of every call is set to BatchElem.Error,
+// the calls are sent one by one when the batch failed, and batch requests are not used again
+// if the node rejected the batch and accepts the single calls, returns error only if ctx is done
+func (c *EvmClient) BatchCall(ctx context.Context, elems []rpc.BatchElem) error {
+	for chunk := range slices.Chunk(elems, c.BatchSize()) {
+		rejected := false
+		if len(chunk) > 1 && !c.noBatch.Load() {
+			err := c.Client.Client().BatchCallContext(ctx, chunk)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == nil && !batchRejected(chunk) {
+				continue
+			}
+			rejected = err == nil || isBatchRejection(err)
+		}
+
+		accepted := false
+		for i := range chunk {
+			chunk[i].Error = c.Client.Client().CallContext(ctx, chunk[i].Result, chunk[i].Method, chunk[i].Args...)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			accepted = accepted || chunk[i].Error == nil
+		}
+		// a transient error of the batch does not disable batch requests
+		if rejected && accepted {
+			c.noBatch.Store(true)
+		}
+	}
+	return nil
+}
+
+// batchRejected every call failed with the error of the batch, e.g. batch requests are not supported or too large
+func batchRejected(elems []rpc.BatchElem) bool {
+	for _, e := range elems {
+		if e.Error == nil || !strings.Contains(strings.ToLower(e.Error.Error()), "batch") {
+			return false
+		}
+	}
+	return true
+}
+
+// isBatchRejection the node rejects the batch request, e.g. http 413 or http 400 batch requests are not supported
+func isBatchRejection(err error) bool {
+	var httpErr rpc.HTTPError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+	return httpErr.StatusCode == http.StatusRequestEntityTooLarge ||
+		httpErr.StatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(string(httpErr.Body)), "batch")
+}
+
+// BatchGet calls method with every args in batches, errs[i] is the error of args[i], ethereum.NotFound if the result is null
+func BatchGet[T any](ctx context.Context, c *EvmClient, method string, args [][]any) ([]*T, []error, error) {
+	results := make([]*T, len(args))
+	elems := make([]rpc.BatchElem, len(args))
+	for i := range args {
+		elems[i] = rpc.BatchElem{Method: method, Args: args[i], Result: &results[i]}
+	}
+	if err := c.BatchCall(ctx, elems); err != nil {
+		return nil, nil, err
+	}
+	errs := make([]error, len(args))
+	for i, e := range elems {
+		errs[i] = e.Error
+		if errs[i] == nil && results[i] == nil {
+			errs[i] = ethereum.NotFound
+		}
+	}
+	return results, errs, nil
+}
+
+// HeadersByRange headers of the blocks [from, to], errs[i] is the error of block from+i
+func (c *EvmClient) HeadersByRange(ctx context.Context, from, to uint64) ([]*types.Header, []error, error) {
+	if to < from {
+		return nil, nil, nil
+	}
+	args := make([][]any, 0, to-from+1)
+	for n := from; n <= to; n++ {
+		args = append(args, []any{hexutil.EncodeUint64(n), false})
+	}
+	return BatchGet[types.Header](ctx, c, "eth_getBlockByNumber", args)
+}
+
+// TransactionReceipts receipts of the transactions, errs[i] is the error of hashes[i]
+func (c *EvmClient) TransactionReceipts(ctx context.Context, hashes []common.Hash) ([]*types.Receipt, []error, error) {
+	args := make([][]any, len(hashes))
+	for i, hash := range hashes {
+		args[i] = []any{hash}
+	}
+	return BatchGet[types.Receipt](ctx, c, "eth_getTransactionReceipt", args)
+}
+
+// CallContracts eth_call of every msg at block, nil block is the latest block, errs[i] is the error of msgs[i]
+func (c *EvmClient) CallContracts(ctx context.Context, msgs []ethereum.CallMsg, block *big.Int) ([][]byte, []error, error) {
+	blockArg := "latest"
+	if block != nil {
+		blockArg = hexutil.EncodeBig(block)
+	}
+	args := make([][]any, len(msgs))
+	for i, msg := range msgs {
+		args[i] = []any{toCallArg(msg), blockArg}
+	}
+	results, errs, err := BatchGet[hexutil.Bytes](ctx, c, "eth_call", args)
+	if err != nil {
+		return nil, nil, err
+	}
+	outs := make([][]byte, len(msgs))
+	for i, out := range results {
+		if out != nil {
+			outs[i] = *out
+		}
+	}
+	return outs, errs, nil
+}
+
+// toCallArg same as ethclient
+func toCallArg(msg ethereum.CallMsg) any {
+	arg := map[string]any{
+		"from": msg.From,
+		"to":   msg.To,
+	}
+	if len(msg.Data) > 0 {
+		arg["input"] = hexutil.Bytes(msg.Data)
+	}
+	if msg.Value != nil {
+		arg["value"] = (*hexutil.Big)(msg.Value)
+	}
+	if msg.Gas != 0 {
+		arg["gas"] = hexutil.Uint64(msg.Gas)
+	}
+	if msg.GasPrice != nil {
+		arg["gasPrice"] = (*hexutil.Big)(msg.GasPrice)
+	}
+	if msg.GasFeeCap != nil {
+		arg["maxFeePerGas"] = (*hexutil.Big)(msg.GasFeeCap)
+	}
+	if msg.GasTipCap != nil {
+		arg["maxPriorityFeePerGas"] = (*hexutil.Big)(msg.GasTipCap)
+	}
+	if msg.AccessList != nil {
+		arg["accessList"] = msg.AccessList
+	}
+	return arg
+}
+
+// BlockReceiptsByRange receipts of the blocks [from, to] by eth_getBlockReceipts, errs[i] is the error of block from+i,
+// the receipts are fetched by the transaction hashes of the blocks when the node does not support eth_getBlockReceipts
+func (c *EvmClient) BlockReceiptsByRange(ctx context.Context, from, to uint64) ([][]*types.Receipt, []error, error) {
+	if to < from {
+		return nil, nil, nil
+	}
+	args := make([][]any, 0, to-from+1)
+	for n := from; n <= to; n++ {
+		args = append(args, []any{hexutil.EncodeUint64(n)})
+	}
+	if !c.noBlockReceipts.Load() {
+		results, errs, err := BatchGet[[]*types.Receipt](ctx, c, "eth_getBlockReceipts", args)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !slices.ContainsFunc(errs, isMethodNotFound) {
+			receipts := make([][]*types.Receipt, len(results))
+			for i, r := range results {
+				if r != nil {
+					receipts[i] = *r
+				}
+			}
+			return receipts, errs, nil
+		}
+		c.noBlockReceipts.Store(true)
+	}
+
+	// tx hashes of the blocks, then the receipts of all transactions in a batch
+	type block struct {
+		Transactions []common.Hash `json:"transactions"`
+	}
+	for i := range args {
+		args[i] = append(args[i], false)
+	}
+	blocks, errs, err := BatchGet[block](ctx, c, "eth_getBlockByNumber", args)
+	if err != nil {
+		return nil, nil, err
+	}
+	var hashes []common.Hash
+	for i, b := range blocks {
+		if errs[i] == nil {
+			hashes = append(hashes, b.Transactions...)
+		}
+	}
+	found, txErrs, err := c.TransactionReceipts(ctx, hashes)
+	if err != nil {
+		return nil, nil, err
+	}
+	receipts := make([][]*types.Receipt, len(blocks))
+	for i, b := range blocks {
+		if errs[i] != nil {
+			continue
+		}
+		receipts[i] = make([]*types.Receipt, 0, len(b.Transactions))
+		for range b.Transactions {
+			if txErrs[0] != nil {
+				errs[i] = fmt.Errorf("receipt of %s, %v", hashes[0], txErrs[0])
+			}
+			receipts[i] = append(receipts[i], found[0])
+			found, txErrs, hashes = found[1:], txErrs[1:], hashes[1:]
+		}
+		if errs[i] != nil {
+			receipts[i] = nil
+		}
+	}
+	return receipts, errs, nil
+}
+
+// isMethodNotFound the node does not support the method, the errors of a lagging node such as
+// "header not available" are not
+func isMethodNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601 {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "method not found") ||
+		strings.Contains(msg, "the method ") && strings.Contains(msg, "does not exist")
+}
@@ -0,0 +1,149 @@
+package rpcclient_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/AcSunday/gwatch-chain/rpcclient"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+func TestHeadersByRange(t *testing.T) {
+	ctx := context.Background()
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(103)
+	client := node.Client(t)
+
+	headers, errs, err := client.HeadersByRange(ctx, 101, 105)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, h := range headers[:3] {
+		if errs[i] != nil || h.Number.Uint64() != uint64(101+i) || h.Time != evmtest.BlockTime(uint64(101+i)) {
+			t.Fatalf("unexpected header %d: %+v, %v", i, h, errs[i])
+		}
+	}
+	if !errors.Is(errs[3], ethereum.NotFound) || !errors.Is(errs[4], ethereum.NotFound) {
+		t.Fatalf("expected not found, got %v", errs[3:])
+	}
+	if node.Calls(evmtest.BatchCalls) != 1 {
+		t.Fatalf("expected a batch, got %d", node.Calls(evmtest.BatchCalls))
+	}
+
+	// chunked to the batch size
+	client.SetBatchSize(2)
+	if _, _, err = client.HeadersByRange(ctx, 98, 103); err != nil {
+		t.Fatal(err)
+	}
+	if node.Calls(evmtest.BatchCalls) != 4 {
+		t.Fatalf("expected 3 more batches, got %d", node.Calls(evmtest.BatchCalls)-1)
+	}
+}
+
+func TestBatchFallback(t *testing.T) {
+	ctx := context.Background()
+	token := common.HexToAddress("0x55d398326f99059ff775485246999027b3197955")
+	tx := types.NewTransaction(1, token, new(big.Int), 60000, big.NewInt(1), nil)
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(110)
+	node.AddTxs(101, evmtest.Tx{Transaction: tx, GasUsed: 21000})
+	node.SetCallResult(token, []byte{1}, []byte{2})
+	node.RejectBatch()
+	client := node.Client(t)
+
+	outs, errs, err := client.CallContracts(ctx, []ethereum.CallMsg{{To: &token, Data: []byte{1}}, {To: &token, Data: []byte{3}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0] != nil || len(outs[0]) != 1 || outs[0][0] != 2 || errs[1] == nil {
+		t.Fatalf("unexpected results: %v, %v", outs, errs)
+	}
+	if node.Calls(evmtest.BatchCalls) != 1 || node.Calls("eth_call") != 2 {
+		t.Fatalf("expected a rejected batch and 2 calls, got %d batches", node.Calls(evmtest.BatchCalls))
+	}
+
+	// batch requests are not sent again
+	receipts, errs, err := client.TransactionReceipts(ctx, []common.Hash{tx.Hash(), {1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0] != nil || receipts[0].GasUsed != 21000 || receipts[0].BlockNumber.Uint64() != 101 || !errors.Is(errs[1], ethereum.NotFound) {
+		t.Fatalf("unexpected receipts: %v, %v", receipts, errs)
+	}
+	if node.Calls(evmtest.BatchCalls) != 1 {
+		t.Fatalf("batch is sent after rejected, got %d batches", node.Calls(evmtest.BatchCalls))
+	}
+}
+
+func TestBatchTransientError(t *testing.T) {
+	ctx := context.Background()
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(110)
+	client := node.Client(t)
+
+	node.FailNextBatch(http.StatusServiceUnavailable)
+	headers, errs, err := client.HeadersByRange(ctx, 101, 103)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, h := range headers {
+		if errs[i] != nil || h.Number.Uint64() != uint64(101+i) {
+			t.Fatalf("unexpected header %d: %+v, %v", i, h, errs[i])
+		}
+	}
+	if node.Calls("eth_getBlockByNumber") != 3 {
+		t.Fatalf("expected the calls are sent one by one, got %d", node.Calls("eth_getBlockByNumber"))
+	}
+
+	// batch requests are still used
+	if _, _, err = client.HeadersByRange(ctx, 101, 103); err != nil {
+		t.Fatal(err)
+	}
+	if node.Calls(evmtest.BatchCalls) != 2 {
+		t.Fatalf("batch is disabled by a transient error, got %d batches", node.Calls(evmtest.BatchCalls))
+	}
+}
+
+func TestBlockReceiptsLaggingNode(t *testing.T) {
+	ctx := context.Background()
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(110)
+	client := node.Client(t)
+
+	node.FailNext("eth_getBlockReceipts", errors.New("header not available"))
+	if _, errs, err := client.BlockReceiptsByRange(ctx, 101, 102); err != nil || errs[0] == nil {
+		t.Fatalf("expected the error of block 101, got %v, %v", errs, err)
+	}
+	// eth_getBlockReceipts is still used
+	if _, errs, err := client.BlockReceiptsByRange(ctx, 101, 102); err != nil || errs[0] != nil {
+		t.Fatalf("unexpected errors %v, %v", errs, err)
+	}
+	if node.Calls("eth_getBlockReceipts") != 4 || node.Calls("eth_getBlockByNumber") != 0 {
+		t.Fatalf("unexpected calls: %d block receipts, %d blocks", node.Calls("eth_getBlockReceipts"), node.Calls("eth_getBlockByNumber"))
+	}
+}
+
+func TestBatchLiteralClient(t *testing.T) {
+	node := evmtest.NewNode(t, 56)
+	node.SetLatest(110)
+	ethClient, err := ethclient.Dial(node.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ethClient.Close()
+	client := &rpcclient.EvmClient{Client: ethClient}
+
+	if client.BatchSize() != rpcclient.DefaultBatchSize {
+		t.Fatalf("unexpected batch size %d", client.BatchSize())
+	}
+	if _, errs, err := client.HeadersByRange(context.Background(), 101, 102); err != nil || errs[0] != nil || errs[1] != nil {
+		t.Fatalf("unexpected errors %v, %v", errs, err)
+	}
+}
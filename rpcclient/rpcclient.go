@@ -3,13 +3,23 @@ package rpcclient
 import (
 	"context"
 	"fmt"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/AcSunday/gwatch-chain/metrics"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 type EvmClient struct {
-	rawurl  string
-	chainId uint64
+	rawurl    string
+	chainId   uint64
+	batchSize atomic.Int64
+	noBatch   atomic.Bool // the node rejects batch requests, see BatchCall
+	// the node does not support eth_getBlockReceipts, see BlockReceiptsByRange
+	noBlockReceipts atomic.Bool
 	*ethclient.Client
 }
 
@@ -17,15 +27,23 @@ func NewEvmRpcClient(rawurl string) (*EvmClient, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	client, err := ethclient.DialContext(ctx, rawurl)
+	// http calls are reported to metrics
+	var opts []rpc.ClientOption
+	if strings.HasPrefix(rawurl, "http://") || strings.HasPrefix(rawurl, "https://") {
+		opts = append(opts, rpc.WithHTTPClient(&http.Client{Transport: metrics.NewTransport(rawurl, nil)}))
+	}
+	rc, err := rpc.DialOptions(ctx, rawurl, opts...)
 	if err != nil {
 		return nil, err
 	}
+	client := ethclient.NewClient(rc)
 	id, err := client.ChainID(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return &EvmClient{rawurl: rawurl, chainId: id.Uint64(), Client: client}, nil
+	c := &EvmClient{rawurl: rawurl, chainId: id.Uint64(), Client: client}
+	c.batchSize.Store(DefaultBatchSize)
+	return c, nil
 }
 
 func MustNewEvmRpcClient(rawurl string) *EvmClient {
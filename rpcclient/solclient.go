@@ -2,9 +2,16 @@ package rpcclient
 
 import (
 	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AcSunday/gwatch-chain/metrics"
 	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
 )
 
+const solClientTimeout = 5 * time.Minute
+
 type SolClient struct {
 	rawurl  string
 	chainId uint64
@@ -18,7 +25,10 @@ func NewSolClient(rawurl string, chainId uint64) (*SolClient, error) {
 	//ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	//defer cancel()
 
-	client := rpc.New(rawurl)
+	// calls are reported to metrics
+	client := rpc.NewWithCustomRPCClient(jsonrpc.NewClientWithOpts(rawurl, &jsonrpc.RPCClientOpts{
+		HTTPClient: &http.Client{Timeout: solClientTimeout, Transport: metrics.NewTransport(rawurl, nil)},
+	}))
 	c := &SolClient{
 		rawurl:  rawurl,
 		chainId: chainId,
@@ -0,0 +1,65 @@
+package sink
+
+import (
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc1155"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc20"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc721"
+)
+
+// Decoded fields of a standard ERC20/721/1155 event, uint256 is a decimal string
+type Decoded struct {
+	Name   string         `json:"name"` // e.g. erc20.Transfer
+	Fields map[string]any `json:"fields"`
+}
+
+// Decode the standard event, returns nil if the event is not ERC20/721/1155
+func Decode(e abs.EventEnvelope) *Decoded {
+	switch e.Event {
+	case erc20.TransferEvent(): // same as erc721.TransferEvent
+		if v, err := erc20.DecodeTransfer(e.Log); err == nil {
+			return &Decoded{Name: "erc20.Transfer", Fields: map[string]any{
+				"from": v.From, "to": v.To, "value": v.Value.String(),
+			}}
+		}
+		if v, err := erc721.DecodeTransfer(e.Log); err == nil {
+			return &Decoded{Name: "erc721.Transfer", Fields: map[string]any{
+				"from": v.From, "to": v.To, "token_id": v.TokenId.String(),
+			}}
+		}
+	case erc20.ApprovalEvent(): // same as erc721.ApprovalEvent
+		if v, err := erc20.DecodeApproval(e.Log); err == nil {
+			return &Decoded{Name: "erc20.Approval", Fields: map[string]any{
+				"owner": v.Owner, "spender": v.Spender, "value": v.Value.String(),
+			}}
+		}
+		if v, err := erc721.DecodeApproval(e.Log); err == nil {
+			return &Decoded{Name: "erc721.Approval", Fields: map[string]any{
+				"owner": v.Owner, "approved": v.Approved, "token_id": v.TokenId.String(),
+			}}
+		}
+	case erc721.ApprovalForAllEvent(): // same as erc1155.ApprovalForAllEvent
+		if v, err := erc721.DecodeApprovalForAll(e.Log); err == nil {
+			return &Decoded{Name: "ApprovalForAll", Fields: map[string]any{
+				"owner": v.Owner, "operator": v.Operator, "approved": v.Approved,
+			}}
+		}
+	case erc1155.TransferSingleEvent():
+		if v, err := erc1155.DecodeTransferSingle(e.Log); err == nil {
+			return &Decoded{Name: "erc1155.TransferSingle", Fields: map[string]any{
+				"operator": v.Operator, "from": v.From, "to": v.To, "id": v.Id.String(), "value": v.Value.String(),
+			}}
+		}
+	case erc1155.TransferBatchEvent():
+		if v, err := erc1155.DecodeTransferBatch(e.Log); err == nil && len(v) > 0 {
+			ids, values := make([]string, len(v)), make([]string, len(v))
+			for i := range v {
+				ids[i], values[i] = v[i].Id.String(), v[i].Value.String()
+			}
+			return &Decoded{Name: "erc1155.TransferBatch", Fields: map[string]any{
+				"operator": v[0].Operator, "from": v[0].From, "to": v[0].To, "ids": ids, "values": values,
+			}}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,2 @@
+// Package sink abs.Sink implementations, JSON Lines files, stdout and signed webhooks
+package sink
@@ -0,0 +1,112 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Record json line of an event
+type Record struct {
+	ChainId     uint64         `json:"chain_id"`
+	Chain       string         `json:"chain"`
+	Contract    common.Address `json:"contract"`
+	Event       string         `json:"event"`
+	BlockNumber uint64         `json:"block_number"`
+	BlockHash   common.Hash    `json:"block_hash"`
+	TxHash      common.Hash    `json:"tx_hash"`
+	TxIndex     uint           `json:"tx_index"`
+	LogIndex    uint           `json:"log_index"`
+	Topics      []common.Hash  `json:"topics"`
+	Data        hexutil.Bytes  `json:"data"`
+	Decoded     *Decoded       `json:"decoded,omitempty"` // see Decode
+}
+
+func NewRecord(e abs.EventEnvelope) Record {
+	return Record{
+		ChainId:     e.ChainId,
+		Chain:       e.Chain,
+		Contract:    e.Contract,
+		Event:       e.Event.String(),
+		BlockNumber: e.BlockNumber,
+		BlockHash:   e.BlockHash,
+		TxHash:      e.TxHash,
+		TxIndex:     e.TxIndex,
+		LogIndex:    e.LogIndex,
+		Topics:      e.Log.Topics,
+		Data:        e.Log.Data,
+	}
+}
+
+// JSONLines writes every event as a json line
+type JSONLines struct {
+	w      *bufio.Writer
+	closer io.Closer
+	sync   func() error // flush to the disk before acknowledge
+	mu     sync.Mutex
+}
+
+// NewJSONLines w is not closed by the sink
+func NewJSONLines(w io.Writer) *JSONLines {
+	return &JSONLines{w: bufio.NewWriter(w)}
+}
+
+// NewFile appends the events to the file, the batch is acknowledged after fsync
+func NewFile(path string) (*JSONLines, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLines{w: bufio.NewWriter(f), closer: f, sync: f.Sync}, nil
+}
+
+// NewStdout writes the events to stdout
+func NewStdout() *JSONLines {
+	return NewJSONLines(os.Stdout)
+}
+
+func (j *JSONLines) Write(ctx context.Context, batch *abs.Batch) error {
+	if len(batch.Events) == 0 {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	enc := json.NewEncoder(j.w)
+	for _, e := range batch.Events {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := enc.Encode(NewRecord(e)); err != nil {
+			return err
+		}
+	}
+	if err := j.w.Flush(); err != nil {
+		return err
+	}
+	if j.sync != nil {
+		return j.sync()
+	}
+	return nil
+}
+
+func (j *JSONLines) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	err := j.w.Flush()
+	if j.closer != nil {
+		if cerr := j.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	s, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := abs.Attrs{ChainId: 1, Chain: "ethereum"}
+	batch := &abs.Batch{ChainId: 1, FromBlock: 10, ToBlock: 12}
+	for i := uint(0); i < 3; i++ {
+		batch.Events = append(batch.Events, abs.NewEventEnvelope(attrs, types.Log{
+			Address:     common.HexToAddress("0x1c7d4b196cb0c7b01d743fbc6116a902379c7238"),
+			Topics:      []common.Hash{{0xdd}},
+			Data:        []byte{byte(i)},
+			BlockNumber: 11,
+			Index:       i,
+		}))
+	}
+	if err = s.Write(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Write(context.Background(), &abs.Batch{FromBlock: 13, ToBlock: 14}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	records := make([]Record, 0, 3)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+	if records[2].LogIndex != 2 || records[2].Data[0] != 2 || records[2].Chain != "ethereum" {
+		t.Fatalf("unexpected record: %+v", records[2])
+	}
+}
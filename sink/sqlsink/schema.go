@@ -0,0 +1,106 @@
+package sqlsink
+
+// uint256 values are stored as decimal text, both SQLite and PostgreSQL can cast it to numeric
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS gwatch_checkpoints (
+		chain_id     BIGINT NOT NULL,
+		name         TEXT   NOT NULL,
+		block_number BIGINT NOT NULL,
+		PRIMARY KEY (chain_id, name)
+	)`,
+	// children of the factories, see abs.RegisterFactory
+	`CREATE TABLE IF NOT EXISTS gwatch_children (
+		chain_id     BIGINT NOT NULL,
+		name         TEXT   NOT NULL,
+		address      TEXT   NOT NULL,
+		factory      TEXT   NOT NULL,
+		start_block  BIGINT NOT NULL,
+		tx_hash      TEXT   NOT NULL,
+		PRIMARY KEY (chain_id, name, address)
+	)`,
+	`CREATE TABLE IF NOT EXISTS gwatch_events (
+		chain_id     BIGINT NOT NULL,
+		tx_hash      TEXT   NOT NULL,
+		log_index    BIGINT NOT NULL,
+		chain        TEXT   NOT NULL,
+		contract     TEXT   NOT NULL,
+		event        TEXT   NOT NULL,
+		block_number BIGINT NOT NULL,
+		block_hash   TEXT   NOT NULL,
+		tx_index     BIGINT NOT NULL,
+		topics       TEXT   NOT NULL,
+		data         TEXT   NOT NULL,
+		PRIMARY KEY (chain_id, tx_hash, log_index)
+	)`,
+	`CREATE TABLE IF NOT EXISTS erc20_transfers (
+		chain_id     BIGINT NOT NULL,
+		tx_hash      TEXT   NOT NULL,
+		log_index    BIGINT NOT NULL,
+		block_number BIGINT NOT NULL,
+		contract     TEXT   NOT NULL,
+		from_address TEXT   NOT NULL,
+		to_address   TEXT   NOT NULL,
+		value        TEXT   NOT NULL,
+		PRIMARY KEY (chain_id, tx_hash, log_index)
+	)`,
+	`CREATE TABLE IF NOT EXISTS erc20_approvals (
+		chain_id     BIGINT NOT NULL,
+		tx_hash      TEXT   NOT NULL,
+		log_index    BIGINT NOT NULL,
+		block_number BIGINT NOT NULL,
+		contract     TEXT   NOT NULL,
+		owner        TEXT   NOT NULL,
+		spender      TEXT   NOT NULL,
+		value        TEXT   NOT NULL,
+		PRIMARY KEY (chain_id, tx_hash, log_index)
+	)`,
+	`CREATE TABLE IF NOT EXISTS erc721_transfers (
+		chain_id     BIGINT NOT NULL,
+		tx_hash      TEXT   NOT NULL,
+		log_index    BIGINT NOT NULL,
+		block_number BIGINT NOT NULL,
+		contract     TEXT   NOT NULL,
+		from_address TEXT   NOT NULL,
+		to_address   TEXT   NOT NULL,
+		token_id     TEXT   NOT NULL,
+		PRIMARY KEY (chain_id, tx_hash, log_index)
+	)`,
+	`CREATE TABLE IF NOT EXISTS erc721_approvals (
+		chain_id     BIGINT NOT NULL,
+		tx_hash      TEXT   NOT NULL,
+		log_index    BIGINT NOT NULL,
+		block_number BIGINT NOT NULL,
+		contract     TEXT   NOT NULL,
+		owner        TEXT   NOT NULL,
+		approved     TEXT   NOT NULL,
+		token_id     TEXT   NOT NULL,
+		PRIMARY KEY (chain_id, tx_hash, log_index)
+	)`,
+	// ApprovalForAll of ERC721 and ERC1155 has the same signature
+	`CREATE TABLE IF NOT EXISTS approvals_for_all (
+		chain_id     BIGINT  NOT NULL,
+		tx_hash      TEXT    NOT NULL,
+		log_index    BIGINT  NOT NULL,
+		block_number BIGINT  NOT NULL,
+		contract     TEXT    NOT NULL,
+		owner        TEXT    NOT NULL,
+		operator     TEXT    NOT NULL,
+		approved     BOOLEAN NOT NULL,
+		PRIMARY KEY (chain_id, tx_hash, log_index)
+	)`,
+	// TransferSingle has batch_index 0, TransferBatch has one row per id
+	`CREATE TABLE IF NOT EXISTS erc1155_transfers (
+		chain_id     BIGINT NOT NULL,
+		tx_hash      TEXT   NOT NULL,
+		log_index    BIGINT NOT NULL,
+		batch_index  BIGINT NOT NULL,
+		block_number BIGINT NOT NULL,
+		contract     TEXT   NOT NULL,
+		operator     TEXT   NOT NULL,
+		from_address TEXT   NOT NULL,
+		to_address   TEXT   NOT NULL,
+		token_id     TEXT   NOT NULL,
+		value        TEXT   NOT NULL,
+		PRIMARY KEY (chain_id, tx_hash, log_index, batch_index)
+	)`,
+}
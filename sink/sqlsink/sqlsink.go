@@ -0,0 +1,252 @@
+// Package sqlsink abs.Sink writing the events and the checkpoint to SQLite or PostgreSQL by database/sql, see SQL
+package sqlsink
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc1155"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc20"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc721"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+type Dialect int
+
+const (
+	SQLite   Dialect = iota // ? placeholders
+	Postgres                // $1 placeholders
+)
+
+const DefaultName = "default"
+
+type Options struct {
+	Dialect Dialect
+	// Name of the checkpoint, watchers sharing the database must use different names, default is "default"
+	Name string
+}
+
+// SQL writes the events and the checkpoint of a batch in one transaction,
+// the rows are keyed on (chain_id, tx_hash, log_index) and inserted only once,
+// so a batch written again after a crash is a no-op.
+// The key must be unique across the watchers sharing the database, a row with the key of a stored row is dropped,
+// the synthetic logs of the native and calls watchers have their own log index keyspace, see abs.NativeLogIndexBase.
+// Restore the processed block number from Checkpoint when starting the watcher.
+//
+// The ERC20/721/1155 events are also decoded into their own tables, every event is stored in gwatch_events.
+type SQL struct {
+	db      *sql.DB
+	dialect Dialect
+	name    string
+}
+
+// New creates the tables if not exist, db is not closed by the sink
+func New(ctx context.Context, db *sql.DB, opts Options) (*SQL, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+	switch opts.Dialect {
+	case SQLite, Postgres:
+	default:
+		return nil, fmt.Errorf("unsupported dialect %d", opts.Dialect)
+	}
+	if opts.Name == "" {
+		opts.Name = DefaultName
+	}
+
+	s := &SQL{db: db, dialect: opts.Dialect, name: opts.Name}
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("create schema failed, %v", err)
+		}
+	}
+	return s, nil
+}
+
+// Checkpoint the processed block number of the chain, ok is false when nothing has been written
+func (s *SQL) Checkpoint(ctx context.Context, chainId uint64) (blockNumber uint64, ok bool, err error) {
+	var n int64
+	err = s.db.QueryRowContext(ctx,
+		s.rebind(`SELECT block_number FROM gwatch_checkpoints WHERE chain_id = ? AND name = ?`),
+		int64(chainId), s.name,
+	).Scan(&n)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint64(n), true, nil
+}
+
+// Children the children of the factories written with the checkpoint, restore them by abs.Contract.AddChildren
+func (s *SQL) Children(ctx context.Context, chainId uint64) ([]abs.Child, error) {
+	rows, err := s.db.QueryContext(ctx,
+		s.rebind(`SELECT address, factory, start_block, tx_hash FROM gwatch_children WHERE chain_id = ? AND name = ? ORDER BY start_block, address`),
+		int64(chainId), s.name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var children []abs.Child
+	for rows.Next() {
+		var (
+			addr, factory, txHash string
+			startBlock            int64
+		)
+		if err = rows.Scan(&addr, &factory, &startBlock, &txHash); err != nil {
+			return nil, err
+		}
+		children = append(children, abs.Child{
+			Address:    common.HexToAddress(addr),
+			Factory:    common.HexToAddress(factory),
+			StartBlock: uint64(startBlock),
+			TxHash:     common.HexToHash(txHash),
+		})
+	}
+	return children, rows.Err()
+}
+
+func (s *SQL) Write(ctx context.Context, batch *abs.Batch) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for _, e := range batch.Events {
+		if err = s.insertEvent(ctx, tx, e); err != nil {
+			return fmt.Errorf("insert event tx %s log %d failed, %v", e.TxHash, e.LogIndex, err)
+		}
+	}
+	for _, child := range batch.Children {
+		err = s.insert(ctx, tx, "gwatch_children", []string{"chain_id", "name", "address", "factory", "start_block", "tx_hash"},
+			int64(batch.ChainId), s.name, address(child.Address), address(child.Factory), int64(child.StartBlock), child.TxHash.Hex())
+		if err != nil {
+			return fmt.Errorf("insert child %s failed, %v", child.Address, err)
+		}
+	}
+
+	// the checkpoint never goes backwards
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO gwatch_checkpoints (chain_id, name, block_number) VALUES (?, ?, ?)
+		ON CONFLICT (chain_id, name) DO UPDATE SET block_number = excluded.block_number
+		WHERE gwatch_checkpoints.block_number < excluded.block_number`),
+		int64(batch.ChainId), s.name, int64(batch.ToBlock),
+	)
+	if err != nil {
+		return fmt.Errorf("update checkpoint failed, %v", err)
+	}
+	return tx.Commit()
+}
+
+// Close db is owned by the caller
+func (s *SQL) Close() error {
+	return nil
+}
+
+func (s *SQL) insertEvent(ctx context.Context, tx *sql.Tx, e abs.EventEnvelope) error {
+	topics := make([]string, len(e.Log.Topics))
+	for i, topic := range e.Log.Topics {
+		topics[i] = topic.Hex()
+	}
+	err := s.insert(ctx, tx, "gwatch_events",
+		[]string{"chain_id", "tx_hash", "log_index", "chain", "contract", "event", "block_number", "block_hash", "tx_index", "topics", "data"},
+		int64(e.ChainId), e.TxHash.Hex(), int64(e.LogIndex), e.Chain, address(e.Contract), e.Event.String(),
+		int64(e.BlockNumber), e.BlockHash.Hex(), int64(e.TxIndex), strings.Join(topics, ","), hexutil.Encode(e.Log.Data),
+	)
+	if err != nil {
+		return err
+	}
+
+	// the log of a non-standard contract which is not decoded is only stored in gwatch_events
+	key := []any{int64(e.ChainId), e.TxHash.Hex(), int64(e.LogIndex), int64(e.BlockNumber), address(e.Contract)}
+	keyColumns := []string{"chain_id", "tx_hash", "log_index", "block_number", "contract"}
+	switch e.Event {
+	case erc20.TransferEvent(): // same as erc721.TransferEvent
+		if v, err := erc20.DecodeTransfer(e.Log); err == nil {
+			return s.insert(ctx, tx, "erc20_transfers", append(keyColumns, "from_address", "to_address", "value"),
+				append(key, address(v.From), address(v.To), v.Value.String())...)
+		}
+		if v, err := erc721.DecodeTransfer(e.Log); err == nil {
+			return s.insert(ctx, tx, "erc721_transfers", append(keyColumns, "from_address", "to_address", "token_id"),
+				append(key, address(v.From), address(v.To), v.TokenId.String())...)
+		}
+	case erc20.ApprovalEvent(): // same as erc721.ApprovalEvent
+		if v, err := erc20.DecodeApproval(e.Log); err == nil {
+			return s.insert(ctx, tx, "erc20_approvals", append(keyColumns, "owner", "spender", "value"),
+				append(key, address(v.Owner), address(v.Spender), v.Value.String())...)
+		}
+		if v, err := erc721.DecodeApproval(e.Log); err == nil {
+			return s.insert(ctx, tx, "erc721_approvals", append(keyColumns, "owner", "approved", "token_id"),
+				append(key, address(v.Owner), address(v.Approved), v.TokenId.String())...)
+		}
+	case erc721.ApprovalForAllEvent():
+		if v, err := erc721.DecodeApprovalForAll(e.Log); err == nil {
+			return s.insert(ctx, tx, "approvals_for_all", append(keyColumns, "owner", "operator", "approved"),
+				append(key, address(v.Owner), address(v.Operator), v.Approved)...)
+		}
+	case erc1155.TransferSingleEvent():
+		if v, err := erc1155.DecodeTransferSingle(e.Log); err == nil {
+			return s.insertERC1155Transfers(ctx, tx, key, keyColumns, []erc1155.Transfer{v})
+		}
+	case erc1155.TransferBatchEvent():
+		if v, err := erc1155.DecodeTransferBatch(e.Log); err == nil {
+			return s.insertERC1155Transfers(ctx, tx, key, keyColumns, v)
+		}
+	}
+	return nil
+}
+
+func (s *SQL) insertERC1155Transfers(ctx context.Context, tx *sql.Tx, key []any, keyColumns []string, transfers []erc1155.Transfer) error {
+	columns := append(keyColumns, "batch_index", "operator", "from_address", "to_address", "token_id", "value")
+	for i, v := range transfers {
+		args := append(append([]any{}, key...), int64(i), address(v.Operator), address(v.From), address(v.To), v.Id.String(), v.Value.String())
+		if err := s.insert(ctx, tx, "erc1155_transfers", columns, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insert ignores the row which already exists
+func (s *SQL) insert(ctx context.Context, tx *sql.Tx, table string, columns []string, args ...any) error {
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
+		table, strings.Join(columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+	_, err := tx.ExecContext(ctx, s.rebind(query), args...)
+	return err
+}
+
+// rebind replaces ? placeholders with $n for PostgreSQL
+func (s *SQL) rebind(query string) string {
+	if s.dialect != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func address(addr common.Address) string {
+	return hexutil.Encode(addr.Bytes())
+}
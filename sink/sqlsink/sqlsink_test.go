@@ -0,0 +1,234 @@
+package sqlsink
+
+import (
+	"context"
+	"database/sql"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc1155"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc20"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc721"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/native"
+	"github.com/AcSunday/gwatch-chain/internal/evmtest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	_ "modernc.org/sqlite"
+)
+
+var (
+	token = common.HexToAddress("0x55d398326f99059ff775485246999027b3197955")
+	nft   = common.HexToAddress("0x1c7d4b196cb0c7b01d743fbc6116a902379c7238")
+)
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "gwatch.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newLog(addr common.Address, block uint64, index uint, topics []common.Hash, data []byte) types.Log {
+	return types.Log{
+		Address:     addr,
+		Topics:      topics,
+		Data:        data,
+		BlockNumber: block,
+		BlockHash:   common.Hash{byte(block)},
+		TxHash:      common.Hash{byte(block), byte(index)},
+		Index:       index,
+	}
+}
+
+func word(v int64) []byte {
+	return common.BigToHash(big.NewInt(v)).Bytes()
+}
+
+func testLogs() []types.Log {
+	from, to := common.BytesToHash(common.Address{1}.Bytes()), common.BytesToHash(common.Address{2}.Bytes())
+	batchData := append(append(append(word(64), word(160)...), append(word(2), word(7)...)...), append(word(8), word(2)...)...)
+	batchData = append(batchData, append(word(1), word(5)...)...)
+	return []types.Log{
+		newLog(token, 101, 0, []common.Hash{common.HexToHash(erc20.TransferEvent().String()), from, to}, word(100)),
+		newLog(nft, 102, 1, []common.Hash{common.HexToHash(erc721.TransferEvent().String()), from, to, common.BigToHash(common.Big3)}, nil),
+		newLog(nft, 102, 2, []common.Hash{common.HexToHash(erc721.ApprovalForAllEvent().String()), from, to}, word(1)),
+		newLog(nft, 103, 0, []common.Hash{common.HexToHash(erc1155.TransferBatchEvent().String()), from, from, to}, batchData),
+	}
+}
+
+func count(t *testing.T, db *sql.DB, table string) int {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestWrite(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	s, err := New(ctx, db, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Checkpoint(ctx, 1); err != nil || ok {
+		t.Fatalf("unexpected checkpoint, ok: %v, err: %v", ok, err)
+	}
+
+	attrs := abs.Attrs{ChainId: 1, Chain: "ethereum"}
+	batch := &abs.Batch{ChainId: 1, FromBlock: 101, ToBlock: 110}
+	for _, l := range testLogs() {
+		batch.Events = append(batch.Events, abs.NewEventEnvelope(attrs, l))
+	}
+
+	// the batch written again after a crash is a no-op
+	for i := 0; i < 2; i++ {
+		if err = s.Write(ctx, batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for table, expected := range map[string]int{
+		"gwatch_events":     4,
+		"erc20_transfers":   1,
+		"erc721_transfers":  1,
+		"approvals_for_all": 1,
+		"erc1155_transfers": 2,
+	} {
+		if n := count(t, db, table); n != expected {
+			t.Fatalf("expected %d rows in %s, got %d", expected, table, n)
+		}
+	}
+
+	var value string
+	if err = db.QueryRow("SELECT value FROM erc1155_transfers WHERE batch_index = 1").Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	if value != "5" {
+		t.Fatalf("unexpected erc1155 value %s", value)
+	}
+
+	// the checkpoint never goes backwards
+	if err = s.Write(ctx, &abs.Batch{ChainId: 1, FromBlock: 90, ToBlock: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if n, ok, err := s.Checkpoint(ctx, 1); err != nil || !ok || n != 110 {
+		t.Fatalf("unexpected checkpoint %d, ok: %v, err: %v", n, ok, err)
+	}
+
+	// nothing is written if the transaction failed
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	batch = &abs.Batch{ChainId: 1, FromBlock: 111, ToBlock: 120, Events: []abs.EventEnvelope{
+		abs.NewEventEnvelope(attrs, newLog(token, 111, 0, testLogs()[0].Topics, word(1))),
+	}}
+	if err = s.Write(canceled, batch); err == nil {
+		t.Fatal("expected context canceled")
+	}
+	if n, _, _ := s.Checkpoint(ctx, 1); n != 110 || count(t, db, "gwatch_events") != 4 {
+		t.Fatalf("partial batch is written, checkpoint %d", n)
+	}
+}
+
+func TestWriteNativeLog(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	attrs := abs.Attrs{ChainId: 1, Chain: "ethereum"}
+	erc20Log := testLogs()[0]
+	// the native transfer of the same transaction at position 0 of the block
+	nativeLog := newLog(common.Address{2}, 101, 0, []common.Hash{common.HexToHash(native.TransferEvent().String()),
+		erc20Log.Topics[1], erc20Log.Topics[2]}, word(5))
+	nativeLog.Index = abs.NativeLogIndexBase
+
+	for name, l := range map[string]types.Log{"erc20": erc20Log, "native": nativeLog} {
+		s, err := New(ctx, db, Options{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch := &abs.Batch{ChainId: 1, FromBlock: 101, ToBlock: 101, Events: []abs.EventEnvelope{abs.NewEventEnvelope(attrs, l)}}
+		if err = s.Write(ctx, batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := count(t, db, "gwatch_events"); n != 2 {
+		t.Fatalf("expected the native row and the erc20 row, got %d", n)
+	}
+}
+
+func TestScanResume(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	node := evmtest.NewNode(t, 1)
+	node.SetLatest(120)
+	node.AddLogs(testLogs()...)
+	client := node.Client(t)
+
+	newWatcher := func() (*abs.Contract, *SQL) {
+		s, err := New(ctx, db, Options{Name: "nft"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		processed, ok, err := s.Checkpoint(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			processed = 100
+		}
+
+		c := &abs.Contract{Addrs: []common.Address{token, nft}}
+		c.Init(abs.Attrs{ChainId: 1, ProcessedBlockNumber: processed, WatchBlockLimit: 2})
+		c.RegisterWatchEvent(erc20.TransferEvent(), erc721.ApprovalForAllEvent(), erc1155.TransferBatchEvent())
+		if err = c.RegisterSink(s); err != nil {
+			t.Fatal(err)
+		}
+		return c, s
+	}
+
+	c, _ := newWatcher()
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	// restart from the checkpoint stored with the events
+	c, s := newWatcher()
+	defer c.Close()
+	if c.GetProcessedBlockNumber() != 103 {
+		t.Fatalf("unexpected processed block number %d", c.GetProcessedBlockNumber())
+	}
+	if err := c.Scan(client); err != nil {
+		t.Fatal(err)
+	}
+	if n, _, _ := s.Checkpoint(ctx, 1); n != 106 {
+		t.Fatalf("unexpected checkpoint %d", n)
+	}
+	if n := count(t, db, "gwatch_events"); n != 4 {
+		t.Fatalf("expected 4 events, got %d", n)
+	}
+}
+
+func TestChildren(t *testing.T) {
+	ctx := context.Background()
+	s, err := New(ctx, openDB(t), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	child := abs.Child{Address: common.Address{0xc1}, Factory: token, StartBlock: 105, TxHash: common.Hash{105}}
+	for i := 0; i < 2; i++ {
+		if err = s.Write(ctx, &abs.Batch{ChainId: 1, FromBlock: 101, ToBlock: 110, Children: []abs.Child{child}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	children, err := s.Children(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 1 || children[0] != child {
+		t.Fatalf("unexpected children: %+v", children)
+	}
+}
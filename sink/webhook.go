@@ -0,0 +1,327 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+)
+
+const (
+	SignatureHeader = "X-Gwatch-Signature" // sha256=hex(hmac_sha256(secret, body))
+	DeliveryHeader  = "X-Gwatch-Delivery"  // id of the payload, the same on every retry, increasing across restarts
+
+	DefaultMaxQueue   = 1000
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 5 * time.Minute
+
+	queueFileExt = ".json"
+	seqFile      = "seq" // the last id, the ids are not reused after the queue is drained
+)
+
+// ErrQueueFull returned by Webhook.Write when the undelivered payloads exceed MaxQueue,
+// the processed block number is not updated and the range is scanned again later
+var ErrQueueFull = errors.New("webhook queue is full")
+
+type WebhookOptions struct {
+	URL      string
+	Secret   []byte
+	QueueDir string // undelivered payloads, delivered again after restart
+
+	MaxQueue   int           // pause scanning when the queue exceeds it, default is 1000
+	MinBackoff time.Duration // default is 1s
+	MaxBackoff time.Duration // default is 5m
+	Client     *http.Client  // default timeout is 10s
+	Logger     *slog.Logger  // default is slog.Default()
+}
+
+// Payload the json body of a webhook request, a batch per request
+type Payload struct {
+	ChainId   uint64   `json:"chain_id"`
+	Chain     string   `json:"chain"`
+	FromBlock uint64   `json:"from_block"`
+	ToBlock   uint64   `json:"to_block"`
+	Events    []Record `json:"events"`
+}
+
+// Webhook POST the batches to URL in order, a batch is acknowledged after it is persisted in QueueDir,
+// it is delivered in the background and retried with exponential backoff until the response is 2xx,
+// so the events are delivered at least once, use the DeliveryHeader to deduplicate
+type Webhook struct {
+	opts WebhookOptions
+
+	mu     sync.Mutex
+	queue  []string // file names in order
+	seq    uint64
+	notify chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewWebhook(opts WebhookOptions) (*Webhook, error) {
+	if opts.URL == "" {
+		return nil, errors.New("webhook url is empty")
+	}
+	if opts.QueueDir == "" {
+		return nil, errors.New("webhook queue dir is empty")
+	}
+	if opts.MaxQueue <= 0 {
+		opts.MaxQueue = DefaultMaxQueue
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = DefaultMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(DefaultMaxBackoff, opts.MinBackoff)
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	if err := os.MkdirAll(opts.QueueDir, 0o755); err != nil {
+		return nil, err
+	}
+	queue, seq, err := loadQueue(opts.QueueDir)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Webhook{opts: opts, queue: queue, seq: seq, notify: make(chan struct{}, 1)}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.wg.Add(1)
+	go w.deliverLoop()
+	if len(queue) > 0 {
+		w.wakeup()
+	}
+	return w, nil
+}
+
+// Sign the value of SignatureHeader
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify the SignatureHeader of a request received by the consumer
+func Verify(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+func (w *Webhook) Write(ctx context.Context, batch *abs.Batch) error {
+	if len(batch.Events) == 0 {
+		return nil
+	}
+	if w.Pending() >= w.opts.MaxQueue {
+		return ErrQueueFull
+	}
+
+	p := Payload{
+		ChainId:   batch.ChainId,
+		Chain:     batch.Chain,
+		FromBlock: batch.FromBlock,
+		ToBlock:   batch.ToBlock,
+		Events:    make([]Record, len(batch.Events)),
+	}
+	for i, e := range batch.Events {
+		p.Events[i] = NewRecord(e)
+		p.Events[i].Decoded = Decode(e)
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.seq++
+	name := fmt.Sprintf("%020d%s", w.seq, queueFileExt)
+	err = writeFileSync(filepath.Join(w.opts.QueueDir, seqFile), []byte(strconv.FormatUint(w.seq, 10)))
+	if err == nil {
+		err = writeFileSync(filepath.Join(w.opts.QueueDir, name), body)
+	}
+	if err == nil {
+		w.queue = append(w.queue, name)
+	}
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	w.wakeup()
+	return nil
+}
+
+// Pending the number of undelivered payloads
+func (w *Webhook) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.queue)
+}
+
+// Close stops the delivery, the undelivered payloads are kept in QueueDir
+func (w *Webhook) Close() error {
+	w.cancel()
+	w.wg.Wait()
+	return nil
+}
+
+func (w *Webhook) wakeup() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Webhook) deliverLoop() {
+	defer w.wg.Done()
+
+	backoff := w.opts.MinBackoff
+	for {
+		w.mu.Lock()
+		var name string
+		if len(w.queue) > 0 {
+			name = w.queue[0]
+		}
+		w.mu.Unlock()
+
+		if name == "" {
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-w.notify:
+			}
+			continue
+		}
+
+		err := w.deliver(name)
+		if err == nil {
+			backoff = w.opts.MinBackoff
+			w.mu.Lock()
+			w.queue = w.queue[1:]
+			w.mu.Unlock()
+			continue
+		}
+		if w.ctx.Err() != nil {
+			return
+		}
+
+		w.opts.Logger.Warn("webhook delivery failed", "delivery", strings.TrimSuffix(name, queueFileExt),
+			"pending", w.Pending(), "retry_after", backoff, "err", err)
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, w.opts.MaxBackoff)
+	}
+}
+
+func (w *Webhook) deliver(name string) error {
+	path := filepath.Join(w.opts.QueueDir, name)
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, strings.TrimSuffix(name, queueFileExt))
+	if len(w.opts.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(w.opts.Secret, body))
+	}
+
+	resp, err := w.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return os.Remove(path)
+}
+
+// loadQueue the undelivered payloads of the last run and the last id
+func loadQueue(dir string) ([]string, uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		queue []string
+		seq   uint64
+	)
+	data, err := os.ReadFile(filepath.Join(dir, seqFile))
+	switch {
+	case err == nil:
+		seq, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid webhook seq file, %v", err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, 0, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, queueFileExt) {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSuffix(name, queueFileExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		queue = append(queue, name)
+		seq = max(seq, n)
+	}
+	sort.Strings(queue)
+	return queue, seq, nil
+}
+
+// writeFileSync the file is complete or absent after a crash
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
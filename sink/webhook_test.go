@@ -0,0 +1,184 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/abs"
+	"github.com/AcSunday/gwatch-chain/chains/evm/contracts/erc20"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type webhookServer struct {
+	*httptest.Server
+	secret []byte
+
+	mu         sync.Mutex
+	fail       int // the number of requests to fail
+	payloads   []Payload
+	deliveries []string // DeliveryHeader of the payloads
+	received   chan struct{}
+}
+
+func newWebhookServer(t *testing.T, secret []byte, fail int) *webhookServer {
+	s := &webhookServer{secret: secret, fail: fail, received: make(chan struct{}, 16)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify(s.secret, body, r.Header.Get(SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.fail > 0 {
+			s.fail--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.payloads = append(s.payloads, p)
+		s.deliveries = append(s.deliveries, r.Header.Get(DeliveryHeader))
+		s.received <- struct{}{}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *webhookServer) wait(t *testing.T, n int) []Payload {
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for payload %d", i)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.payloads
+}
+
+func transferBatch(from, to uint64) *abs.Batch {
+	attrs := abs.Attrs{ChainId: 1, Chain: "ethereum"}
+	return &abs.Batch{ChainId: 1, Chain: "ethereum", FromBlock: from, ToBlock: to, Events: []abs.EventEnvelope{
+		abs.NewEventEnvelope(attrs, types.Log{
+			Address:     common.HexToAddress("0x55d398326f99059ff775485246999027b3197955"),
+			Topics:      []common.Hash{common.HexToHash(erc20.TransferEvent().String()), {1}, {2}},
+			Data:        common.LeftPadBytes([]byte{100}, 32),
+			BlockNumber: from,
+		}),
+	}}
+}
+
+func TestWebhook(t *testing.T) {
+	secret := []byte("secret")
+	server := newWebhookServer(t, secret, 2)
+	dir := t.TempDir()
+
+	w, err := NewWebhook(WebhookOptions{URL: server.URL, Secret: secret, QueueDir: dir, MinBackoff: time.Millisecond, MaxQueue: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []*abs.Batch{transferBatch(1, 10), transferBatch(11, 20)} {
+		if err = w.Write(context.Background(), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// delivered in order after the failures are retried
+	payloads := server.wait(t, 2)
+	if len(payloads) != 2 || payloads[0].FromBlock != 1 || payloads[1].FromBlock != 11 {
+		t.Fatalf("unexpected payloads: %+v", payloads)
+	}
+	decoded := payloads[0].Events[0].Decoded
+	if decoded == nil || decoded.Name != "erc20.Transfer" || decoded.Fields["value"] != "100" {
+		t.Fatalf("unexpected decoded event: %+v", decoded)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebhookQueue(t *testing.T) {
+	secret := []byte("secret")
+	server := newWebhookServer(t, secret, 0)
+	dir := t.TempDir()
+
+	// the consumer is down, the payloads are kept in the queue
+	w, err := NewWebhook(WebhookOptions{URL: "http://127.0.0.1:1", Secret: secret, QueueDir: dir, MinBackoff: time.Hour, MaxQueue: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []*abs.Batch{transferBatch(1, 10), transferBatch(11, 20)} {
+		if err = w.Write(context.Background(), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Write(context.Background(), transferBatch(21, 30)); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected queue full, got %v", err)
+	}
+	w.Close()
+
+	// delivered after restart
+	w, err = NewWebhook(WebhookOptions{URL: server.URL, Secret: secret, QueueDir: dir, MinBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.Write(context.Background(), transferBatch(21, 30)); err != nil {
+		t.Fatal(err)
+	}
+	payloads := server.wait(t, 3)
+	if payloads[0].FromBlock != 1 || payloads[2].FromBlock != 21 {
+		t.Fatalf("unexpected payloads order: %+v", payloads)
+	}
+	for i := 0; i < 100 && w.Pending() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if w.Pending() != 0 {
+		t.Fatalf("expected empty queue, got %d", w.Pending())
+	}
+}
+
+func TestWebhookRestartAfterDrain(t *testing.T) {
+	secret := []byte("secret")
+	server := newWebhookServer(t, secret, 0)
+	dir := t.TempDir()
+
+	for i, b := range []*abs.Batch{transferBatch(1, 10), transferBatch(11, 20)} {
+		w, err := NewWebhook(WebhookOptions{URL: server.URL, Secret: secret, QueueDir: dir, MinBackoff: time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Write(context.Background(), b); err != nil {
+			t.Fatal(err)
+		}
+		server.wait(t, 1)
+		for j := 0; j < 100 && w.Pending() > 0; j++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if w.Pending() != 0 {
+			t.Fatalf("run %d: expected empty queue, got %d", i, w.Pending())
+		}
+		w.Close()
+	}
+
+	// the queue is drained before the restart, the id of the new payload is not reused
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.deliveries) != 2 || server.deliveries[0] >= server.deliveries[1] {
+		t.Fatalf("unexpected deliveries: %v", server.deliveries)
+	}
+}
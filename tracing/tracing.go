@@ -0,0 +1,70 @@
+// Package tracing OpenTelemetry spans of scan cycles, rpc calls and hooks,
+// the global TracerProvider is used by default, which is noop until otel.SetTracerProvider is called
+package tracing
+
+import (
+	"context"
+
+	"github.com/AcSunday/gwatch-chain/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const ScopeName = "github.com/AcSunday/gwatch-chain"
+
+// span names
+const (
+	ScanSpan = "gwatch.scan"
+	HookSpan = "gwatch.hook"
+	SinkSpan = "gwatch.sink"
+)
+
+// attribute keys
+const (
+	ChainIdKey     = attribute.Key("gwatch.chain_id")
+	ChainKey       = attribute.Key("gwatch.chain")
+	FromBlockKey   = attribute.Key("gwatch.from_block")
+	ToBlockKey     = attribute.Key("gwatch.to_block")
+	LogsKey        = attribute.Key("gwatch.logs")
+	EventKey       = attribute.Key("gwatch.event")
+	ContractKey    = attribute.Key("gwatch.contract")
+	BlockNumberKey = attribute.Key("gwatch.block_number")
+	TxHashKey      = attribute.Key("gwatch.tx_hash")
+	LogIndexKey    = attribute.Key("gwatch.log_index")
+	ProgramIdKey   = attribute.Key("gwatch.program_id")
+	TxSigKey       = attribute.Key("gwatch.tx_sig")
+	NodeKey        = attribute.Key("server.address") // scheme and host of the rpc url
+	RPCMethodKey   = attribute.Key("rpc.method")
+	RPCSystemKey   = attribute.Key("rpc.system")
+)
+
+// Tracer of tp, the global TracerProvider if tp is nil
+func Tracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(ScopeName)
+}
+
+// StartRPC span of a json-rpc call, the span name is the method
+func StartRPC(ctx context.Context, tracer trace.Tracer, rawurl, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			RPCSystemKey.String("jsonrpc"),
+			RPCMethodKey.String(method),
+			NodeKey.String(metrics.NodeLabel(rawurl)),
+		),
+	)
+}
+
+// End records err and ends the span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
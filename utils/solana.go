@@ -9,7 +9,10 @@ import (
 )
 
 // for solana
-const ProgramDataPrefix = "Program data: "
+const (
+	ProgramLogPrefix  = "Program "
+	ProgramDataPrefix = "Program data: "
+)
 
 // UnmarshalBorsh for solana
 func UnmarshalBorsh(dataBytes []byte, obj any) error {